@@ -0,0 +1,260 @@
+// Package keyenc encodes tuples of values as strings whose bytewise order is the
+// order of the tuples, compared element by element. The B+ tree compares keys as
+// plain strings, so keys built with keyenc make numbers and timestamps sort by value
+// and composite keys such as (tenant, createdAt) sort by their first element, then
+// their second.
+//
+// Each element is a type code followed by its payload:
+//
+//	int64      0x10, 8 bytes big endian with the sign bit flipped
+//	float64    0x11, 8 bytes big endian with the sign bit flipped, or every bit
+//	           flipped for negative numbers
+//	bool       0x12, 0x00 or 0x01
+//	time.Time  0x13, the Unix seconds like an int64, then 4 bytes of nanoseconds
+//	string     0x14, the bytes with 0x00 escaped as 0x00 0xFF, then 0x00 0x01
+//	[]byte     0x15, like string
+//
+// An element wrapped in Desc is written with every byte inverted, type code
+// included, so that it sorts in reverse. Elements are self-delimiting: a tuple's
+// encoding is a prefix of the encoding of every longer tuple that starts with the
+// same elements, and of no other, so all keys that start with some elements can be
+// found with a prefix scan.
+package keyenc
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+	"time"
+)
+
+const (
+	intCode    byte = 0x10
+	floatCode  byte = 0x11
+	boolCode   byte = 0x12
+	timeCode   byte = 0x13
+	stringCode byte = 0x14
+	bytesCode  byte = 0x15
+)
+
+// ErrCorrupt is returned when Decode is given a string that keyenc did not produce.
+var ErrCorrupt = errors.New("keyenc: corrupt key")
+
+// Desc wraps an element that should sort in descending order.
+type Desc struct {
+	Value any
+}
+
+// Encode encodes a tuple of values. Values can be int, int32, int64, float64, bool,
+// time.Time, string, []byte, or any of those wrapped in Desc.
+func Encode(Values ...any) (string, error) {
+	var Key []byte
+	for _, Value := range Values {
+		var err error
+		if Key, err = Append(Key, Value); err != nil {
+			return "", err
+		}
+	}
+	return string(Key), nil
+}
+
+// Append appends the encoding of one element to Key.
+func Append(Key []byte, Value any) ([]byte, error) {
+	if Descending, IsDesc := Value.(Desc); IsDesc {
+		if _, Nested := Descending.Value.(Desc); Nested {
+			return nil, fmt.Errorf("keyenc: Desc cannot wrap another Desc")
+		}
+		var Start int = len(Key)
+		Key, err := Append(Key, Descending.Value)
+		if err != nil {
+			return nil, err
+		}
+		for i := Start; i < len(Key); i++ {
+			Key[i] = ^Key[i]
+		}
+		return Key, nil
+	}
+
+	switch Value := Value.(type) {
+	case int:
+		return appendInt(append(Key, intCode), int64(Value)), nil
+	case int32:
+		return appendInt(append(Key, intCode), int64(Value)), nil
+	case int64:
+		return appendInt(append(Key, intCode), Value), nil
+	case float64:
+		var Bits uint64 = math.Float64bits(Value)
+		if Bits>>63 == 1 {
+			Bits = ^Bits
+		} else {
+			Bits |= 1 << 63
+		}
+		return binary.BigEndian.AppendUint64(append(Key, floatCode), Bits), nil
+	case bool:
+		if Value {
+			return append(Key, boolCode, 1), nil
+		}
+		return append(Key, boolCode, 0), nil
+	case time.Time:
+		Key = appendInt(append(Key, timeCode), Value.Unix())
+		return binary.BigEndian.AppendUint32(Key, uint32(Value.Nanosecond())), nil
+	case string:
+		return appendEscaped(append(Key, stringCode), Value), nil
+	case []byte:
+		return appendEscaped(append(Key, bytesCode), string(Value)), nil
+	default:
+		return nil, fmt.Errorf("keyenc: cannot encode %T", Value)
+	}
+}
+
+// Decode decodes a tuple written by Encode. Integers come back as int64, times in
+// UTC, and descending elements wrapped in Desc.
+func Decode(Key string) ([]any, error) {
+	var Values []any
+	for Key != "" {
+		Value, Rest, err := decodeElement(Key)
+		if err != nil {
+			return nil, err
+		}
+		Values = append(Values, Value)
+		Key = Rest
+	}
+	return Values, nil
+}
+
+// String formats an encoded key for messages, as a tuple like ("acme", 42). Keys
+// that do not decode are quoted instead.
+func String(Key string) string {
+	Values, err := Decode(Key)
+	if err != nil {
+		return fmt.Sprintf("%q", Key)
+	}
+	var Items []string = make([]string, len(Values))
+	for i, Value := range Values {
+		Items[i] = formatValue(Value)
+	}
+	return "(" + strings.Join(Items, ", ") + ")"
+}
+
+// formatValue formats one decoded element for String.
+func formatValue(Value any) string {
+	switch Value := Value.(type) {
+	case Desc:
+		return "desc " + formatValue(Value.Value)
+	case string:
+		return fmt.Sprintf("%q", Value)
+	case []byte:
+		return fmt.Sprintf("%x", Value)
+	case time.Time:
+		return Value.Format(time.RFC3339Nano)
+	default:
+		return fmt.Sprint(Value)
+	}
+}
+
+// appendInt appends an int64 payload, flipping the sign bit so that negative
+// numbers sort before positive ones.
+func appendInt(Key []byte, Value int64) []byte {
+	return binary.BigEndian.AppendUint64(Key, uint64(Value)^(1<<63))
+}
+
+// appendEscaped appends a string payload and its terminator.
+func appendEscaped(Key []byte, Value string) []byte {
+	for i := 0; i < len(Value); i++ {
+		if Value[i] == 0x00 {
+			Key = append(Key, 0x00, 0xff)
+		} else {
+			Key = append(Key, Value[i])
+		}
+	}
+	return append(Key, 0x00, 0x01)
+}
+
+// decodeElement decodes the first element of Key and returns the rest.
+func decodeElement(Key string) (any, string, error) {
+	if Key[0] >= 0x80 {
+		Value, Rest, err := decodeElement(invert(Key))
+		if err != nil {
+			return nil, "", err
+		}
+		return Desc{Value: Value}, Key[len(Key)-len(Rest):], nil
+	}
+
+	var Code byte = Key[0]
+	Key = Key[1:]
+	switch Code {
+	case intCode, floatCode:
+		if len(Key) < 8 {
+			return nil, "", ErrCorrupt
+		}
+		var Bits uint64 = binary.BigEndian.Uint64([]byte(Key[:8]))
+		if Code == intCode {
+			return int64(Bits ^ (1 << 63)), Key[8:], nil
+		}
+		if Bits>>63 == 1 {
+			Bits &^= 1 << 63
+		} else {
+			Bits = ^Bits
+		}
+		return math.Float64frombits(Bits), Key[8:], nil
+	case boolCode:
+		if len(Key) < 1 || Key[0] > 1 {
+			return nil, "", ErrCorrupt
+		}
+		return Key[0] == 1, Key[1:], nil
+	case timeCode:
+		if len(Key) < 12 {
+			return nil, "", ErrCorrupt
+		}
+		var Seconds int64 = int64(binary.BigEndian.Uint64([]byte(Key[:8])) ^ (1 << 63))
+		var Nanoseconds uint32 = binary.BigEndian.Uint32([]byte(Key[8:12]))
+		return time.Unix(Seconds, int64(Nanoseconds)).UTC(), Key[12:], nil
+	case stringCode, bytesCode:
+		Value, Rest, err := decodeEscaped(Key)
+		if err != nil {
+			return nil, "", err
+		}
+		if Code == bytesCode {
+			return []byte(Value), Rest, nil
+		}
+		return Value, Rest, nil
+	default:
+		return nil, "", fmt.Errorf("%w: unknown type code 0x%02x", ErrCorrupt, Code)
+	}
+}
+
+// decodeEscaped decodes a string payload and returns the rest of the key after its
+// terminator.
+func decodeEscaped(Key string) (string, string, error) {
+	var Builder strings.Builder
+	for i := 0; i < len(Key); i++ {
+		if Key[i] != 0x00 {
+			Builder.WriteByte(Key[i])
+			continue
+		}
+		if i+1 == len(Key) {
+			break
+		}
+		switch Key[i+1] {
+		case 0xff:
+			Builder.WriteByte(0x00)
+			i++
+		case 0x01:
+			return Builder.String(), Key[i+2:], nil
+		default:
+			return "", "", ErrCorrupt
+		}
+	}
+	return "", "", fmt.Errorf("%w: unterminated string", ErrCorrupt)
+}
+
+// invert returns Key with every byte inverted.
+func invert(Key string) string {
+	var Inverted []byte = []byte(Key)
+	for i := range Inverted {
+		Inverted[i] = ^Inverted[i]
+	}
+	return string(Inverted)
+}
@@ -0,0 +1,81 @@
+package keyenc
+
+import (
+	"math"
+	"math/rand"
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+)
+
+func TestEncodePreservesOrder(t *testing.T) {
+	var Base time.Time = time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	// Each group is listed in ascending order.
+	var Groups [][]any = [][]any{
+		{int64(math.MinInt64), int64(-10), int64(-2), int64(0), int64(2), int64(10), int64(math.MaxInt64)},
+		{math.Inf(-1), -1e10, -2.5, -1e-300, 0.0, 1e-300, 2.5, 1e10, math.Inf(1)},
+		{false, true},
+		{Base.Add(-time.Hour * 24 * 365 * 100), Base.Add(-time.Nanosecond), Base, Base.Add(time.Nanosecond), Base.Add(time.Second)},
+		{"", "\x00", "\x00\x00", "\x00\x01", "a", "a\x00", "a\x00b", "aa", "ab", "b", "\xff", "\xff\xff"},
+		{Desc{"b"}, Desc{"ab"}, Desc{"aa"}, Desc{"a\x00b"}, Desc{"a\x00"}, Desc{"a"}, Desc{""}},
+		{Desc{int64(10)}, Desc{int64(2)}, Desc{int64(-5)}},
+	}
+	for _, Group := range Groups {
+		var Keys []string
+		for _, Value := range Group {
+			// A trailing value checks that each encoding ends where it should.
+			Key, err := Encode(Value, "tail")
+			if err != nil {
+				t.Fatalf("Encode(%#v): %v", Value, err)
+			}
+			Keys = append(Keys, Key)
+			Values, err := Decode(Key)
+			if err != nil || len(Values) != 2 || Values[1] != "tail" {
+				t.Fatalf("Decode(Encode(%#v)) = %#v, %v", Value, Values, err)
+			}
+			if Time, IsTime := Value.(time.Time); IsTime {
+				if !Values[0].(time.Time).Equal(Time) {
+					t.Fatalf("time %v decoded as %v", Time, Values[0])
+				}
+			} else if !reflect.DeepEqual(Values[0], Value) {
+				t.Fatalf("%#v decoded as %#v", Value, Values[0])
+			}
+		}
+		if !sort.StringsAreSorted(Keys) {
+			t.Fatalf("encodings of %#v are out of order", Group)
+		}
+	}
+}
+
+func TestEncodeCompositeKeys(t *testing.T) {
+	var Random *rand.Rand = rand.New(rand.NewSource(1))
+	var Keys []string
+	for i := 0; i < 200; i++ {
+		Key, err := Encode([]string{"a", "ab", "b"}[Random.Intn(3)], int64(Random.Intn(1000)-500))
+		if err != nil {
+			t.Fatal(err)
+		}
+		Keys = append(Keys, Key)
+	}
+	sort.Strings(Keys)
+	for i := 1; i < len(Keys); i++ {
+		Previous, _ := Decode(Keys[i-1])
+		Current, _ := Decode(Keys[i])
+		if Previous[0].(string) > Current[0].(string) || (Previous[0] == Current[0] && Previous[1].(int64) > Current[1].(int64)) {
+			t.Fatalf("%v sorts before %v", Previous, Current)
+		}
+	}
+}
+
+func TestDecodeRejectsBadKeys(t *testing.T) {
+	if _, err := Decode("\x14abc"); err == nil {
+		t.Fatal("Decode accepted an unterminated string")
+	}
+	if _, err := Encode(struct{}{}); err == nil {
+		t.Fatal("Encode accepted an unsupported type")
+	}
+	if Text := String("\x99"); Text == "" {
+		t.Fatal("String of an invalid key is empty")
+	}
+}
@@ -0,0 +1,521 @@
+package storage
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"sort"
+	"strconv"
+	"sync"
+)
+
+// BinaryFileHandler stores pages in fixed-size slots of a binary file, so that page
+// N is read and written with a single ReadAt or WriteAt at offset N * PageSize. It
+// has the same method set as TextFileHandler, which remains available as a
+// human-readable debug format.
+//
+// Slot 0 holds the file header:
+//
+//	magic [8]byte, version uint32, page size uint32, page count uint32,
+//	deallocated count uint32, checkpoint LSN uint64, free-list page uint32,
+//	deallocated PageIDs []uint32
+//
+// Deallocated pages that do not fit in slot 0 are listed on free-list pages, a
+// chain of "FreeList" pages that starts at the header's free-list page. Each holds
+// the PageID of the next one under "Next" and its share of the list under "Pages",
+// as uint32s. Free-list pages are reserved for the list and never deallocated.
+//
+// Version 1 files have no checkpoint LSN and version 2 files no free-list page;
+// they are upgraded when the header is next written.
+//
+// Every other slot holds a uint32 payload length followed by the payload: uvarint
+// PageID, uvarint LSN, the page type, a uvarint entry count and the entries, with
+// each string written as a uvarint length and its bytes. A zero length marks a slot
+// that has never been written. All integers are little endian.
+type BinaryFileHandler struct {
+	FilePath         string
+	File             *os.File
+	SyncMode         SyncMode
+	Mutex            sync.RWMutex
+	pageSize         int
+	pageCount        uint
+	checkpointLSN    uint64
+	DeallocatedPages []uint
+	freeListPages    []uint   // The chain of free-list pages, in order
+	freeListImages   []string // The encoded contents of each free-list page
+}
+
+const BinaryFileMagic string = "twoDBbin"
+const BinaryFileVersion uint32 = 3
+
+// binaryHeaderSize is the size of the fixed part of the file header.
+const binaryHeaderSize int = 36
+
+// binaryHeaderSizeV2 is the size of the fixed part of a version 2 file header.
+const binaryHeaderSizeV2 int = 32
+
+// binaryHeaderSizeV1 is the size of the fixed part of a version 1 file header.
+const binaryHeaderSizeV1 int = 24
+
+// freeListPageOverhead bounds the bytes of a free-list page's slot that are not
+// PageIDs: the payload length, the page header and the two entry names.
+const freeListPageOverhead int = 64
+
+// NewBinaryFileHandler creates a new handler for a binary database file.
+// It either creates a new file or opens an existing one.
+func NewBinaryFileHandler(FilePath string) (*BinaryFileHandler, error) {
+	var FileHandler *BinaryFileHandler = &BinaryFileHandler{
+		FilePath:         FilePath,
+		pageSize:         DefaultPageSize,
+		pageCount:        0,
+		DeallocatedPages: []uint{},
+	}
+
+	var Error error
+	if _, Error = os.Stat(FilePath); os.IsNotExist(Error) {
+		FileHandler.File, Error = os.Create(FilePath)
+		if Error != nil {
+			return nil, fmt.Errorf("Failed to create database file: %w", Error)
+		}
+		if Error = FileHandler.writeHeader(); Error != nil {
+			FileHandler.File.Close()
+			return nil, fmt.Errorf("Failed to initialize database file: %w", Error)
+		}
+		if Error = FileHandler.File.Sync(); Error != nil {
+			FileHandler.File.Close()
+			return nil, fmt.Errorf("Failed to sync database file: %w", Error)
+		}
+		if Error = syncDirectory(FilePath); Error != nil {
+			FileHandler.File.Close()
+			return nil, Error
+		}
+		return FileHandler, nil
+	}
+
+	FileHandler.File, Error = os.OpenFile(FilePath, os.O_RDWR, 0644)
+	if Error != nil {
+		return nil, fmt.Errorf("Failed to open database file: %w", Error)
+	}
+	if Error = FileHandler.LoadMetadata(); Error != nil {
+		FileHandler.File.Close()
+		return nil, Error
+	}
+	return FileHandler, nil
+}
+
+// LoadMetadata reads the file header to load configuration.
+// The page count is raised to cover every slot in the file if the header is behind.
+func (self *BinaryFileHandler) LoadMetadata() error {
+	var Header []byte = make([]byte, binaryHeaderSize)
+	if _, Error := self.File.ReadAt(Header, 0); Error != nil {
+		return fmt.Errorf("Failed to read database header: %w", Error)
+	}
+	if string(Header[0:8]) != BinaryFileMagic {
+		return fmt.Errorf("Not a binary database file: %s", self.FilePath)
+	}
+	var Version uint32 = binary.LittleEndian.Uint32(Header[8:12])
+	if Version > BinaryFileVersion {
+		return fmt.Errorf("Unsupported binary file version %d", Version)
+	}
+	self.pageSize = int(binary.LittleEndian.Uint32(Header[12:16]))
+	self.pageCount = uint(binary.LittleEndian.Uint32(Header[16:20]))
+	if self.pageSize < binaryHeaderSize {
+		return fmt.Errorf("Invalid page size in database header: %d", self.pageSize)
+	}
+
+	var DeallocatedCount int = int(binary.LittleEndian.Uint32(Header[20:24]))
+	var ListOffset int = binaryHeaderSizeV1
+	var ListPageID uint = 0
+	if Version >= 2 {
+		self.checkpointLSN = binary.LittleEndian.Uint64(Header[24:32])
+		ListOffset = binaryHeaderSizeV2
+	}
+	if Version >= 3 {
+		ListPageID = uint(binary.LittleEndian.Uint32(Header[32:36]))
+		ListOffset = binaryHeaderSize
+	}
+	var List []byte = make([]byte, 4*DeallocatedCount)
+	if _, Error := self.File.ReadAt(List, int64(ListOffset)); Error != nil {
+		return fmt.Errorf("Failed to read deallocated pages: %w", Error)
+	}
+	for i := 0; i < DeallocatedCount; i++ {
+		self.DeallocatedPages = append(self.DeallocatedPages, uint(binary.LittleEndian.Uint32(List[4*i:])))
+	}
+
+	Info, Error := self.File.Stat()
+	if Error != nil {
+		return Error
+	}
+	if Slots := uint(Info.Size() / int64(self.pageSize)); Slots > 0 {
+		self.pageCount = max(self.pageCount, Slots-1)
+	}
+
+	// Follow the free-list pages for the deallocated pages the header had no room for
+	for ListPageID != 0 {
+		if len(self.freeListPages) >= int(self.pageCount) {
+			return fmt.Errorf("Free-list pages form a cycle at page %d", ListPageID)
+		}
+		ListPage, Error := self.readSlot(ListPageID)
+		if Error != nil {
+			return fmt.Errorf("Failed to read free-list page %d: %w", ListPageID, Error)
+		}
+		var Entries string = ListPage.Data["Pages"]
+		for i := 0; i+4 <= len(Entries); i += 4 {
+			self.DeallocatedPages = append(self.DeallocatedPages, uint(binary.LittleEndian.Uint32([]byte(Entries[i:i+4]))))
+		}
+		self.freeListPages = append(self.freeListPages, ListPageID)
+		self.freeListImages = append(self.freeListImages, string(encodeBinaryPage(ListPage)))
+
+		Next, Error := strconv.ParseUint(ListPage.Data["Next"], 10, 32)
+		if Error != nil {
+			return fmt.Errorf("Free-list page %d is corrupt: %w", ListPageID, Error)
+		}
+		ListPageID = uint(Next)
+	}
+	return nil
+}
+
+// writeHeader writes slot 0 from the handler's current state. Deallocated pages that
+// do not fit in the slot are written to the free-list pages first.
+func (self *BinaryFileHandler) writeHeader() error {
+	var Deallocated []uint = self.DeallocatedPages
+	var InHeader int = min(len(Deallocated), (self.pageSize-binaryHeaderSize)/4)
+	if Error := self.writeFreeList(Deallocated[InHeader:]); Error != nil {
+		return Error
+	}
+	Deallocated = Deallocated[:InHeader]
+
+	var Header []byte = make([]byte, binaryHeaderSize, self.pageSize)
+	copy(Header[0:8], BinaryFileMagic)
+	binary.LittleEndian.PutUint32(Header[8:12], BinaryFileVersion)
+	binary.LittleEndian.PutUint32(Header[12:16], uint32(self.pageSize))
+	binary.LittleEndian.PutUint32(Header[16:20], uint32(self.pageCount))
+	binary.LittleEndian.PutUint32(Header[20:24], uint32(len(Deallocated)))
+	binary.LittleEndian.PutUint64(Header[24:32], self.checkpointLSN)
+	if len(self.freeListPages) > 0 {
+		binary.LittleEndian.PutUint32(Header[32:36], uint32(self.freeListPages[0]))
+	}
+	for _, PageID := range Deallocated {
+		Header = binary.LittleEndian.AppendUint32(Header, uint32(PageID))
+	}
+
+	if _, Error := self.File.WriteAt(Header[:self.pageSize], 0); Error != nil {
+		return fmt.Errorf("Failed to write database header: %w", Error)
+	}
+	return nil
+}
+
+// writeFreeList writes the deallocated pages that do not fit in the header to the
+// free-list pages, reserving another page at the end of the file whenever the chain
+// is full. Pages already in the chain are kept even when the list shrinks, and a
+// page is only rewritten when its contents change.
+func (self *BinaryFileHandler) writeFreeList(Rest []uint) error {
+	var PerPage int = (self.pageSize - freeListPageOverhead) / 4
+	for len(self.freeListPages)*PerPage < len(Rest) {
+		self.pageCount++
+		self.freeListPages = append(self.freeListPages, self.pageCount)
+		self.freeListImages = append(self.freeListImages, "")
+	}
+
+	for i, PageID := range self.freeListPages {
+		var Entries []byte
+		for _, Free := range Rest[min(i*PerPage, len(Rest)):min((i+1)*PerPage, len(Rest))] {
+			Entries = binary.LittleEndian.AppendUint32(Entries, uint32(Free))
+		}
+		var Next uint = 0
+		if i+1 < len(self.freeListPages) {
+			Next = self.freeListPages[i+1]
+		}
+		var ListPage *Page = &Page{
+			Header: PageHeader{PageID: PageID, PageType: "FreeList"},
+			Data:   map[string]string{"Next": strconv.FormatUint(uint64(Next), 10), "Pages": string(Entries)},
+		}
+		if Image := string(encodeBinaryPage(ListPage)); Image != self.freeListImages[i] {
+			if Error := self.writeSlot(ListPage); Error != nil {
+				return Error
+			}
+			self.freeListImages[i] = Image
+		}
+	}
+	return nil
+}
+
+// CheckpointLSN returns the LSN of the last checkpoint recorded in the header.
+func (self *BinaryFileHandler) CheckpointLSN() uint64 {
+	self.Mutex.RLock()
+	defer self.Mutex.RUnlock()
+	return self.checkpointLSN
+}
+
+// SetCheckpointLSN records a checkpoint in the header and syncs the file.
+func (self *BinaryFileHandler) SetCheckpointLSN(LSN uint64) error {
+	self.Mutex.Lock()
+	defer self.Mutex.Unlock()
+
+	self.checkpointLSN = LSN
+	if Error := self.writeHeader(); Error != nil {
+		return Error
+	}
+	return syncFile(self.File, self.SyncMode)
+}
+
+// ReadPage reads a specific page by its ID from the database file.
+func (self *BinaryFileHandler) ReadPage(PageID uint) (*Page, error) {
+	self.Mutex.RLock()
+	defer self.Mutex.RUnlock()
+
+	if PageID == 0 || PageID > self.pageCount {
+		return nil, fmt.Errorf("Invalid PageID: %d, PageCount: %d", PageID, self.pageCount)
+	}
+	return self.readSlot(PageID)
+}
+
+// readSlot reads and decodes the page in a slot. The caller holds the lock.
+func (self *BinaryFileHandler) readSlot(PageID uint) (*Page, error) {
+	var Slot []byte = make([]byte, self.pageSize)
+	if _, Error := self.File.ReadAt(Slot, int64(PageID)*int64(self.pageSize)); Error != nil && !errors.Is(Error, io.EOF) {
+		return nil, fmt.Errorf("Failed to read page %d: %w", PageID, Error)
+	}
+
+	var Length uint32 = binary.LittleEndian.Uint32(Slot[0:4])
+	if Length == 0 {
+		return nil, fmt.Errorf("%w: PageID %d", ErrPageNotFound, PageID)
+	}
+	if int(Length) > self.pageSize-4 {
+		return nil, fmt.Errorf("Page %d is corrupt: payload of %d bytes", PageID, Length)
+	}
+
+	Page, Error := decodeBinaryPage(Slot[4 : 4+Length])
+	if Error != nil {
+		return nil, fmt.Errorf("Page %d is corrupt: %w", PageID, Error)
+	}
+	if Page.Header.PageID != PageID {
+		return nil, fmt.Errorf("Page %d is corrupt: slot holds page %d", PageID, Page.Header.PageID)
+	}
+	return Page, nil
+}
+
+// WritePage writes a page into its slot in the database file.
+// It returns ErrPageOverflow if the encoded page does not fit in PageSize.
+func (self *BinaryFileHandler) WritePage(Page *Page) error {
+	self.Mutex.Lock()
+	defer self.Mutex.Unlock()
+
+	if Page.Header.PageID == 0 {
+		return fmt.Errorf("Invalid PageID: 0 is reserved for the file header")
+	}
+	if Error := self.writeSlot(Page); Error != nil {
+		return Error
+	}
+
+	// Update Page Count in header if the file grew
+	if Page.Header.PageID >= self.pageCount {
+		self.pageCount = Page.Header.PageID
+		if Error := self.writeHeader(); Error != nil {
+			return Error
+		}
+	}
+	if self.SyncMode == SyncFull {
+		return self.File.Sync()
+	}
+	return nil
+}
+
+// writeSlot encodes a page into its slot. The caller holds the write lock.
+func (self *BinaryFileHandler) writeSlot(Page *Page) error {
+	var Payload []byte = encodeBinaryPage(Page)
+	if len(Payload)+4 > self.pageSize {
+		return fmt.Errorf("%w: page %d is %d bytes, limit is %d", ErrPageOverflow, Page.Header.PageID, len(Payload)+4, self.pageSize)
+	}
+
+	var Slot []byte = make([]byte, self.pageSize)
+	binary.LittleEndian.PutUint32(Slot[0:4], uint32(len(Payload)))
+	copy(Slot[4:], Payload)
+	if _, Error := self.File.WriteAt(Slot, int64(Page.Header.PageID)*int64(self.pageSize)); Error != nil {
+		return fmt.Errorf("Failed to write page %d: %w", Page.Header.PageID, Error)
+	}
+	return nil
+}
+
+// PageSize returns the size of a page in bytes.
+func (self *BinaryFileHandler) PageSize() int {
+	return self.pageSize
+}
+
+// PageCount returns the highest PageID allocated so far.
+func (self *BinaryFileHandler) PageCount() uint {
+	self.Mutex.RLock()
+	defer self.Mutex.RUnlock()
+	return self.pageCount
+}
+
+// IsDeallocated reports whether a page is on the deallocated list.
+func (self *BinaryFileHandler) IsDeallocated(PageID uint) bool {
+	self.Mutex.RLock()
+	defer self.Mutex.RUnlock()
+	return slices.Contains(self.DeallocatedPages, PageID)
+}
+
+// Sync commits the database file to stable storage, unless SyncMode is SyncOff.
+func (self *BinaryFileHandler) Sync() error {
+	self.Mutex.Lock()
+	defer self.Mutex.Unlock()
+	return syncFile(self.File, self.SyncMode)
+}
+
+// Close syncs and closes the database file.
+func (self *BinaryFileHandler) Close() error {
+	self.Mutex.Lock()
+	defer self.Mutex.Unlock()
+	if self.File == nil {
+		return nil
+	}
+	var SyncErr error = syncFile(self.File, self.SyncMode)
+	if Error := self.File.Close(); Error != nil {
+		return Error
+	}
+	return SyncErr
+}
+
+// AllocatePage finds an available page ID to use for new data. The most recently
+// freed page is reused first, so that only the end of the deallocated list changes.
+// A reused page is taken off the list straight away, so that it cannot be handed
+// out twice if its first write never reaches the file. The header is synced before
+// the page is handed out: the list is not in the write-ahead log, so a transaction
+// that commits a reused page must not find it listed as free after a power loss.
+func (self *BinaryFileHandler) AllocatePage() (*Page, error) {
+	self.Mutex.Lock()
+	defer self.Mutex.Unlock()
+
+	var PageID uint
+	if Count := len(self.DeallocatedPages); Count > 0 {
+		PageID = self.DeallocatedPages[Count-1]
+		self.DeallocatedPages = self.DeallocatedPages[:Count-1]
+		var Error error = self.writeHeader()
+		if Error == nil {
+			Error = syncFile(self.File, self.SyncMode)
+		}
+		if Error != nil {
+			self.DeallocatedPages = append(self.DeallocatedPages, PageID)
+			return nil, Error
+		}
+	} else {
+		self.pageCount++
+		PageID = self.pageCount
+	}
+
+	var NewPage *Page = &Page{
+		Header: PageHeader{
+			PageID: PageID,
+		},
+		Data: make(map[string]string),
+	}
+	return NewPage, nil
+}
+
+// FreePage returns a page to the deallocated list so that AllocatePage can reuse it,
+// and records the list in the header so that the page is still reused after a restart.
+func (self *BinaryFileHandler) FreePage(PageID uint) error {
+	self.Mutex.Lock()
+	defer self.Mutex.Unlock()
+
+	if PageID == 0 || PageID > self.pageCount {
+		return fmt.Errorf("Invalid PageID: %d, PageCount: %d", PageID, self.pageCount)
+	}
+	if slices.Contains(self.DeallocatedPages, PageID) {
+		return fmt.Errorf("Page %d is already deallocated", PageID)
+	}
+	self.DeallocatedPages = append(self.DeallocatedPages, PageID)
+	if Error := self.writeHeader(); Error != nil {
+		self.DeallocatedPages = self.DeallocatedPages[:len(self.DeallocatedPages)-1]
+		return Error
+	}
+	return nil
+}
+
+// encodeBinaryPage serializes a page into a slot payload. Entries are written in key
+// order so that the same page always produces the same bytes.
+func encodeBinaryPage(Page *Page) []byte {
+	var Payload []byte
+	Payload = binary.AppendUvarint(Payload, uint64(Page.Header.PageID))
+	Payload = binary.AppendUvarint(Payload, Page.Header.PageLSN)
+	Payload = appendBinaryString(Payload, Page.Header.PageType)
+
+	var Keys []string = make([]string, 0, len(Page.Data))
+	for Key := range Page.Data {
+		Keys = append(Keys, Key)
+	}
+	sort.Strings(Keys)
+
+	Payload = binary.AppendUvarint(Payload, uint64(len(Keys)))
+	for _, Key := range Keys {
+		Payload = appendBinaryString(Payload, Key)
+		Payload = appendBinaryString(Payload, Page.Data[Key])
+	}
+	return Payload
+}
+
+// decodeBinaryPage parses a slot payload written by encodeBinaryPage.
+func decodeBinaryPage(Payload []byte) (*Page, error) {
+	var Reader *bytes.Reader = bytes.NewReader(Payload)
+
+	PageID, Error := binary.ReadUvarint(Reader)
+	if Error != nil {
+		return nil, Error
+	}
+	PageLSN, Error := binary.ReadUvarint(Reader)
+	if Error != nil {
+		return nil, Error
+	}
+	PageType, Error := readBinaryString(Reader)
+	if Error != nil {
+		return nil, Error
+	}
+	Count, Error := binary.ReadUvarint(Reader)
+	if Error != nil {
+		return nil, Error
+	}
+
+	var Page *Page = &Page{
+		Header: PageHeader{PageLSN: PageLSN, PageID: uint(PageID), PageType: PageType},
+		Data:   make(map[string]string, Count),
+	}
+	for i := uint64(0); i < Count; i++ {
+		Key, Error := readBinaryString(Reader)
+		if Error != nil {
+			return nil, Error
+		}
+		Value, Error := readBinaryString(Reader)
+		if Error != nil {
+			return nil, Error
+		}
+		Page.Data[Key] = Value
+	}
+	return Page, nil
+}
+
+// appendBinaryString appends a uvarint length followed by the bytes of s.
+func appendBinaryString(Buffer []byte, s string) []byte {
+	Buffer = binary.AppendUvarint(Buffer, uint64(len(s)))
+	return append(Buffer, s...)
+}
+
+// readBinaryString reads a string written by appendBinaryString.
+func readBinaryString(Reader *bytes.Reader) (string, error) {
+	Length, Error := binary.ReadUvarint(Reader)
+	if Error != nil {
+		return "", Error
+	}
+	if Length > uint64(Reader.Len()) {
+		return "", fmt.Errorf("string of %d bytes runs past the end of the page", Length)
+	}
+	var Buffer []byte = make([]byte, Length)
+	if _, Error := io.ReadFull(Reader, Buffer); Error != nil {
+		return "", Error
+	}
+	return string(Buffer), nil
+}
@@ -0,0 +1,107 @@
+package storage
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestBinaryFileHandlerRoundTrip(t *testing.T) {
+	var Path string = testPath(t)
+	Handler, err := NewBinaryFileHandler(Path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 5; i++ {
+		Page, err := Handler.AllocatePage()
+		if err != nil {
+			t.Fatal(err)
+		}
+		Page.Header.PageType = "Data"
+		Page.Header.PageLSN = uint64(i * 1000)
+		Page.Data["k\n:"] = fmt.Sprintf("v%d\x00|", i)
+		if err := Handler.WritePage(Page); err != nil {
+			t.Fatalf("WritePage: %v", err)
+		}
+	}
+	var Big *Page = &Page{Header: PageHeader{PageID: 2}, Data: map[string]string{"x": strings.Repeat("a", 5000)}}
+	if err := Handler.WritePage(Big); err == nil {
+		t.Fatal("WritePage accepted a page larger than the page size")
+	}
+	if err := Handler.FreePage(3); err != nil {
+		t.Fatal(err)
+	}
+	if err := Handler.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	Handler, err = NewBinaryFileHandler(Path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer Handler.Close()
+	if Handler.PageCount() != 5 {
+		t.Fatalf("PageCount is %d after reopening, want 5", Handler.PageCount())
+	}
+	if !Handler.IsDeallocated(3) {
+		t.Fatal("page 3 is no longer on the free list after reopening")
+	}
+	Page, err := Handler.ReadPage(4)
+	if err != nil || Page.Data["k\n:"] != "v3\x00|" || Page.Header.PageLSN != 3000 || Page.Header.PageType != "Data" {
+		t.Fatalf("ReadPage(4) = %+v, %v", Page, err)
+	}
+	if _, err := Handler.ReadPage(6); err == nil {
+		t.Fatal("ReadPage past the end succeeded")
+	}
+}
+
+func TestBinaryFileHandlerKeepsLongFreeList(t *testing.T) {
+	var Path string = testPath(t)
+	Handler, err := NewBinaryFileHandler(Path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// More freed pages than the header has room for.
+	for i := 0; i < 2500; i++ {
+		Page, err := Handler.AllocatePage()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := Handler.WritePage(Page); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for PageID := uint(1); PageID <= 2500; PageID++ {
+		if err := Handler.FreePage(PageID); err != nil {
+			t.Fatal(err)
+		}
+	}
+	var Before uint = Handler.PageCount()
+	if err := Handler.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	Handler, err = NewBinaryFileHandler(Path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer Handler.Close()
+	if len(Handler.DeallocatedPages) != 2500 {
+		t.Fatalf("%d pages on the free list after reopening, want 2500", len(Handler.DeallocatedPages))
+	}
+	for i := 0; i < 2500; i++ {
+		Page, err := Handler.AllocatePage()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if Page.Header.PageID > 2500 {
+			t.Fatalf("AllocatePage returned page %d with pages still free", Page.Header.PageID)
+		}
+	}
+	if Handler.PageCount() != Before {
+		t.Fatalf("page count grew from %d to %d", Before, Handler.PageCount())
+	}
+	if Page, err := Handler.ReadPage(Before); err != nil || Page.Header.PageType != "FreeList" {
+		t.Fatalf("ReadPage(%d) = %v, %v, want a free-list page", Before, Page, err)
+	}
+}
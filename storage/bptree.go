@@ -1,18 +1,47 @@
 package storage
 
 import (
+	"errors"
 	"fmt"
+	"math"
+	"slices"
 	"sort"
 	"strconv"
 	"strings"
+	"sync"
 )
 
-const BTreeOrder = 4 // A small order for demonstration purposes
+// BTreeOrder is the fixed order of indexes created before the order was recorded
+// in the metadata page.
+const BTreeOrder = 4
+
+// ErrKeyNotFound is returned when a key is not present in the tree.
+var ErrKeyNotFound = errors.New("key not found")
 
 // BPlusTree represents the B+ Tree structure.
+//
+// Find, Insert, Delete and cursors can be called from several goroutines at once.
+// Every page has a read/write latch, and operations crab down the tree: a reader
+// latches a child before releasing its parent, and a writer keeps its ancestors
+// latched only until it reaches a node that can absorb a split or merge by itself.
+// Writers to different parts of the tree do not block each other on the way
+// down, but every Insert and Delete then updates KeyCount in the metadata page
+// under metaMutex, so their final step, and the metadata page write it logs, is
+// serialized. Database serializes all of its writes anyway; see Database.
+//
+// Keys are compared bytewise, as Go strings. Numbers, timestamps and composite keys
+// sort correctly when they are built with keyenc.
 type BPlusTree struct {
-	RootPageID  uint
-	FileHandler *TextFileHandler
+	MetaPageID uint
+	RootPageID uint
+	Height     uint   // Number of levels, 1 while the root is a leaf
+	KeyCount   uint64 // Number of keys stored in the leaves
+	Order      int    // Maximum children per node, or 0 to fill nodes up to the page size
+	Store      PageStore
+	keyLimit   int          // Largest key a tree of fixed order accepts; see maxKeySize
+	rootLatch  sync.RWMutex // Guards RootPageID while a writer may replace the root
+	metaMutex  sync.Mutex   // Guards Height, KeyCount and the metadata page
+	latches    latchTable
 }
 
 // BTreeNode represents a node in the B+ Tree.
@@ -25,118 +54,629 @@ type BTreeNode struct {
 	NextLeaf uint     // For leaf nodes, Page ID of the next leaf
 }
 
-// NewBPlusTree initializes a new B+ Tree.
-func NewBPlusTree(FileHandler *TextFileHandler) (*BPlusTree, error) {
-	// Check if a root page already exists
-	// A real implementation would store the root PageID in a metadata page (e.g., Page 1)
-	RootPage, err := FileHandler.ReadPage(1)
-	if err != nil { // Assuming error means it doesn't exist, create it
-		RootPage, err = FileHandler.AllocatePage()
-		if err != nil {
+// NewBPlusTree opens the tree described by the metadata page, creating the
+// metadata page and an empty root leaf if the file has no pages yet. Order only
+// applies to a new tree; an existing tree keeps the order it was created with.
+func NewBPlusTree(Store PageStore, Order int) (*BPlusTree, error) {
+	tree := &BPlusTree{
+		MetaPageID: MetaPageID,
+		Order:      Order,
+		Store:      Store,
+	}
+
+	if Store.PageCount() == 0 {
+		if err := tree.checkOrder(); err != nil {
 			return nil, err
 		}
-		RootPage.Header.PageType = "Index"
-		RootPage.Data["IsLeaf"] = "true"
-		RootPage.Data["Keys"] = ""
-		RootPage.Data["Pointers"] = ""
-		if err := FileHandler.WritePage(RootPage); err != nil {
+		if err := tree.create(); err != nil {
 			return nil, err
 		}
+		return tree, nil
 	}
 
-	return &BPlusTree{
-		RootPageID:  RootPage.Header.PageID,
-		FileHandler: FileHandler,
-	}, nil
+	MetaPage, err := Store.ReadPage(tree.MetaPageID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read index metadata: %w", err)
+	}
+	switch MetaPage.Header.PageType {
+	case "Meta":
+		err = tree.loadMeta(MetaPage)
+	case "Index":
+		err = tree.upgradeLegacyRoot(MetaPage)
+	default:
+		err = fmt.Errorf("page %d is a %s page, expected index metadata", tree.MetaPageID, MetaPage.Header.PageType)
+	}
+	if err != nil {
+		return nil, err
+	}
+	tree.keyLimit = tree.fixedKeyLimit()
+	return tree, nil
 }
 
-// Insert adds a key and its data pointer to the tree.
+// Insert adds a key and its data pointer to the tree, splitting nodes on the way
+// back up and growing a new root when the old one overflows.
 func (tree *BPlusTree) Insert(key string, pageID uint, entryIndex uint) error {
-	// This is a simplified insert. A full implementation is very complex,
-	// involving node splitting and parent updates.
-	RootNode, err := tree.readNode(tree.RootPageID)
+	if err := tree.checkKey(key); err != nil {
+		return err
+	}
+	pointer := fmt.Sprintf("%d:%d", pageID, entryIndex)
+
+	var Path *latchPath = &latchPath{Tree: tree}
+	Path.lockRoot()
+	defer Path.releaseAll()
+	splitKey, splitPageID, err := tree.insertInto(tree.RootPageID, key, pointer, Path)
 	if err != nil {
 		return err
 	}
 
-	// For simplicity, we'll just add to the root if it's a leaf and not full.
-	if RootNode.IsLeaf && len(RootNode.Keys) < BTreeOrder-1 {
-		pointer := fmt.Sprintf("%d:%d", pageID, entryIndex)
+	tree.metaMutex.Lock()
+	defer tree.metaMutex.Unlock()
+	tree.KeyCount++
+	if splitPageID == 0 {
+		return tree.writeMeta()
+	}
 
-		insertIndex := sort.SearchStrings(RootNode.Keys, key)
+	// The root was split, so the tree grows by one level.
+	RootPage, err := tree.Store.AllocatePage()
+	if err != nil {
+		return err
+	}
+	RootPage.Header.PageType = "Index"
+	RootNode := &BTreeNode{
+		Page:     RootPage,
+		IsLeaf:   false,
+		Keys:     []string{splitKey},
+		Children: []uint{tree.RootPageID, splitPageID},
+	}
+	if err := tree.writeNode(RootNode); err != nil {
+		return err
+	}
+	tree.RootPageID = RootPage.Header.PageID
+	tree.Height++
+	return tree.writeMeta()
+}
+
+// insertInto inserts a key into the subtree rooted at pageID. If the node had to be
+// split, it returns the separator key and the PageID of the new right sibling so the
+// caller can add them to the parent. The node stays latched until the insert is
+// done; its ancestors are released as soon as it is known not to split.
+func (tree *BPlusTree) insertInto(pageID uint, key string, pointer string, Path *latchPath) (string, uint, error) {
+	Path.lock(pageID)
+	Node, err := tree.readNode(pageID)
+	if err != nil {
+		return "", 0, err
+	}
+	if tree.canAbsorbInsert(Node, key) {
+		Path.releaseAncestors()
+	}
 
-		RootNode.Keys = append(RootNode.Keys[:insertIndex], append([]string{key}, RootNode.Keys[insertIndex:]...)...)
-		RootNode.Pointers = append(RootNode.Pointers[:insertIndex], append([]string{pointer}, RootNode.Pointers[insertIndex:]...)...)
+	if Node.IsLeaf {
+		insertIndex := sort.SearchStrings(Node.Keys, key)
+		if insertIndex < len(Node.Keys) && Node.Keys[insertIndex] == key {
+			return "", 0, fmt.Errorf("key '%s' already exists in index", key)
+		}
+		Node.Keys = slices.Insert(Node.Keys, insertIndex, key)
+		Node.Pointers = slices.Insert(Node.Pointers, insertIndex, pointer)
+	} else {
+		childIndex := childIndexFor(Node.Keys, key)
+		splitKey, splitPageID, err := tree.insertInto(Node.Children[childIndex], key, pointer, Path)
+		if err != nil || splitPageID == 0 {
+			return "", 0, err
+		}
+		Node.Keys = slices.Insert(Node.Keys, childIndex, splitKey)
+		Node.Children = slices.Insert(Node.Children, childIndex+1, splitPageID)
+	}
 
-		return tree.writeNode(RootNode)
+	if !tree.isOverfull(Node) {
+		return "", 0, tree.writeNode(Node)
 	}
+	return tree.splitNode(Node)
+}
 
-	// A full implementation would find the correct leaf, insert, and split if necessary,
-	// propagating splits up the tree.
-	fmt.Println("Warning: B+ Tree insert is simplified. Node splitting not implemented.")
-	return nil
+// splitNode moves the upper half of an overfull node into a newly allocated sibling.
+// Leaves copy their first remaining key up to the parent, internal nodes move their
+// middle key up.
+func (tree *BPlusTree) splitNode(node *BTreeNode) (string, uint, error) {
+	SiblingPage, err := tree.Store.AllocatePage()
+	if err != nil {
+		return "", 0, err
+	}
+	SiblingPage.Header.PageType = "Index"
+	Sibling := &BTreeNode{
+		Page:   SiblingPage,
+		IsLeaf: node.IsLeaf,
+	}
+
+	mid := len(node.Keys) / 2
+	var splitKey string
+	if node.IsLeaf {
+		Sibling.Keys = slices.Clone(node.Keys[mid:])
+		Sibling.Pointers = slices.Clone(node.Pointers[mid:])
+		node.Keys = node.Keys[:mid]
+		node.Pointers = node.Pointers[:mid]
+		splitKey = Sibling.Keys[0]
+
+		// Link the new leaf into the chain right after the node it was split from.
+		Sibling.NextLeaf = node.NextLeaf
+		node.NextLeaf = SiblingPage.Header.PageID
+	} else {
+		splitKey = node.Keys[mid]
+		Sibling.Keys = slices.Clone(node.Keys[mid+1:])
+		Sibling.Children = slices.Clone(node.Children[mid+1:])
+		node.Keys = node.Keys[:mid]
+		node.Children = node.Children[:mid+1]
+	}
+
+	if err := tree.writeNode(Sibling); err != nil {
+		return "", 0, err
+	}
+	if err := tree.writeNode(node); err != nil {
+		return "", 0, err
+	}
+	return splitKey, SiblingPage.Header.PageID, nil
+}
+
+// childIndexFor returns the index of the child subtree that may contain key.
+// Keys[i] is the smallest key reachable through Children[i+1].
+func childIndexFor(keys []string, key string) int {
+	return sort.Search(len(keys), func(i int) bool {
+		return keys[i] > key
+	})
 }
 
 // Find searches for a key in the tree and returns its data location.
+// It returns ErrKeyNotFound if the key is not in the tree.
 func (tree *BPlusTree) Find(key string) (uint, uint, error) {
-	Node, err := tree.readNode(tree.RootPageID)
+	Leaf, err := tree.findLeaf(key)
 	if err != nil {
 		return 0, 0, err
 	}
 
-	// Simplified find: only searches the root leaf node.
-	if !Node.IsLeaf {
-		fmt.Println("Warning: B+ Tree find is simplified. Only searching root leaf.")
-		return 0, 0, fmt.Errorf("cannot find in non-leaf root (not implemented)")
+	i := sort.SearchStrings(Leaf.Keys, key)
+	if i == len(Leaf.Keys) || Leaf.Keys[i] != key {
+		return 0, 0, ErrKeyNotFound
 	}
+	return parsePointer(Leaf.Pointers[i])
+}
+
+// findLeaf descends from the root through internal nodes to the leaf that
+// would contain key.
+func (tree *BPlusTree) findLeaf(key string) (*BTreeNode, error) {
+	return tree.descendShared(func(Node *BTreeNode) int {
+		return childIndexFor(Node.Keys, key)
+	})
+}
 
-	for i, k := range Node.Keys {
-		if k == key {
-			var pageID, entryIndex uint64
-			parts := strings.Split(Node.Pointers[i], ":")
-			pageID, _ = strconv.ParseUint(parts[0], 10, 32)
-			entryIndex, _ = strconv.ParseUint(parts[1], 10, 32)
-			return uint(pageID), uint(entryIndex), nil
+// descendShared walks from the root to a leaf, following the child that Next picks
+// at each internal node. It holds shared latches, taking each child's latch before
+// releasing its parent's, so it never sees a node halfway through a split or merge.
+func (tree *BPlusTree) descendShared(Next func(*BTreeNode) int) (*BTreeNode, error) {
+	tree.rootLatch.RLock()
+	var PageID uint = tree.RootPageID
+	tree.latches.lock(PageID, false)
+	tree.rootLatch.RUnlock()
+	return tree.descendSharedFrom(PageID, Next)
+}
+
+// descendSharedFrom continues descendShared from a page the caller has latched.
+func (tree *BPlusTree) descendSharedFrom(PageID uint, Next func(*BTreeNode) int) (*BTreeNode, error) {
+	for {
+		Node, err := tree.readNode(PageID)
+		if err == nil && !Node.IsLeaf && len(Node.Children) == 0 {
+			err = fmt.Errorf("internal node on page %d has no children", PageID)
+		}
+		if err != nil || Node.IsLeaf {
+			tree.latches.unlock(PageID, false)
+			return Node, err
 		}
+		var ChildID uint = Node.Children[Next(Node)]
+		tree.latches.lock(ChildID, false)
+		tree.latches.unlock(PageID, false)
+		PageID = ChildID
 	}
+}
 
-	return 0, 0, nil // Not found
+// readShared reads a single node under a shared latch.
+func (tree *BPlusTree) readShared(pageID uint) (*BTreeNode, error) {
+	tree.latches.lock(pageID, false)
+	defer tree.latches.unlock(pageID, false)
+	return tree.readNode(pageID)
 }
 
-// Delete removes a key from the tree.
+// parsePointer splits a leaf pointer of the form "PageID:EntryIndex".
+func parsePointer(pointer string) (uint, uint, error) {
+	parts := strings.Split(pointer, ":")
+	if len(parts) != 2 {
+		return 0, 0, fmt.Errorf("corrupt index pointer '%s'", pointer)
+	}
+	pageID, err := strconv.ParseUint(parts[0], 10, 32)
+	if err != nil {
+		return 0, 0, fmt.Errorf("corrupt index pointer '%s': %w", pointer, err)
+	}
+	entryIndex, err := strconv.ParseUint(parts[1], 10, 32)
+	if err != nil {
+		return 0, 0, fmt.Errorf("corrupt index pointer '%s': %w", pointer, err)
+	}
+	return uint(pageID), uint(entryIndex), nil
+}
+
+// Delete removes a key from the tree. Nodes left underfull borrow from or merge
+// with a sibling, and the root collapses by one level when it has a single child.
 func (tree *BPlusTree) Delete(key string) error {
-	// A full implementation involves finding the key, removing it, and potentially
-	// merging or redistributing keys/pointers in nodes.
-	fmt.Println("Warning: B+ Tree delete is simplified.")
-	Node, err := tree.readNode(tree.RootPageID)
+	var Path *latchPath = &latchPath{Tree: tree}
+	Path.lockRoot()
+	defer Path.releaseAll()
+	Root, err := tree.deleteFrom(tree.RootPageID, key, Path)
+	if err != nil {
+		return err
+	}
+
+	tree.metaMutex.Lock()
+	defer tree.metaMutex.Unlock()
+	tree.KeyCount--
+
+	if !Root.IsLeaf && len(Root.Keys) == 0 {
+		OldRootID := tree.RootPageID
+		tree.RootPageID = Root.Children[0]
+		tree.Height--
+		if err := tree.writeMeta(); err != nil {
+			return err
+		}
+		return tree.Store.FreePage(OldRootID)
+	}
+	return tree.writeMeta()
+}
+
+// deleteFrom removes key from the subtree rooted at pageID and returns the updated
+// node so that the caller can check whether it needs rebalancing. The node stays
+// latched until the delete is done; its ancestors are released as soon as it is
+// known not to need rebalancing.
+func (tree *BPlusTree) deleteFrom(pageID uint, key string, Path *latchPath) (*BTreeNode, error) {
+	Path.lock(pageID)
+	Node, err := tree.readNode(pageID)
 	if err != nil {
+		return nil, err
+	}
+	if tree.canAbsorbDelete(Node, key, Path.atRoot()) {
+		Path.releaseAncestors()
+	}
+
+	if Node.IsLeaf {
+		i := sort.SearchStrings(Node.Keys, key)
+		if i == len(Node.Keys) || Node.Keys[i] != key {
+			return nil, ErrKeyNotFound
+		}
+		Node.Keys = slices.Delete(Node.Keys, i, i+1)
+		Node.Pointers = slices.Delete(Node.Pointers, i, i+1)
+		return Node, tree.writeNode(Node)
+	}
+
+	childIndex := childIndexFor(Node.Keys, key)
+	Child, err := tree.deleteFrom(Node.Children[childIndex], key, Path)
+	if err != nil {
+		return nil, err
+	}
+	// A child can have been underfull before this delete. Once the path no longer
+	// holds this node, a node below absorbed the delete and neither is changed.
+	if !Path.holds(pageID) || !tree.isUnderfull(Child) {
+		return Node, nil
+	}
+	return Node, tree.rebalanceChild(Node, childIndex, Child, Path)
+}
+
+// rebalanceChild fixes an underfull child of parent, either by borrowing one entry
+// from an adjacent sibling or by merging the two nodes into one. The sibling is
+// latched while parent is, so no other writer can be inside it.
+func (tree *BPlusTree) rebalanceChild(parent *BTreeNode, childIndex int, child *BTreeNode, Path *latchPath) error {
+	// Work on the pair Children[sep] and Children[sep+1], preferring the left sibling.
+	sep := childIndex - 1
+	if childIndex == 0 {
+		sep = 0
+	}
+
+	var Left, Right *BTreeNode
+	var err error
+	if sep == childIndex {
+		Left = child
+		Path.lock(parent.Children[sep+1])
+		if Right, err = tree.readNode(parent.Children[sep+1]); err != nil {
+			return err
+		}
+	} else {
+		Right = child
+		Path.lock(parent.Children[sep])
+		if Left, err = tree.readNode(parent.Children[sep]); err != nil {
+			return err
+		}
+	}
+
+	// Borrow a single entry if the sibling does not become underfull without it.
+	if child == Right && tree.canSpare(Left, false) {
+		tree.borrowFromLeft(parent, sep, Left, Right)
+	} else if child == Left && tree.canSpare(Right, true) {
+		tree.borrowFromRight(parent, sep, Left, Right)
+	} else {
+		return tree.mergeChildren(parent, sep, Left, Right)
+	}
+	if err := tree.writeNode(Left); err != nil {
 		return err
 	}
+	if err := tree.writeNode(Right); err != nil {
+		return err
+	}
+	return tree.writeNode(parent)
+}
+
+// mergeChildren folds right into left and drops the separator between them from
+// parent. Under a page-fill order the merge is skipped if the result would not fit,
+// leaving the underfull node in place.
+func (tree *BPlusTree) mergeChildren(parent *BTreeNode, sep int, left *BTreeNode, right *BTreeNode) error {
+	Merged := left.clone()
+	if Merged.IsLeaf {
+		Merged.Keys = append(Merged.Keys, right.Keys...)
+		Merged.Pointers = append(Merged.Pointers, right.Pointers...)
+		Merged.NextLeaf = right.NextLeaf
+	} else {
+		Merged.Keys = append(append(Merged.Keys, parent.Keys[sep]), right.Keys...)
+		Merged.Children = append(Merged.Children, right.Children...)
+	}
+	if tree.isOverfull(Merged) {
+		return nil
+	}
 
-	if !Node.IsLeaf {
-		return fmt.Errorf("cannot delete from non-leaf root (not implemented)")
+	*left = *Merged
+	parent.Keys = slices.Delete(parent.Keys, sep, sep+1)
+	parent.Children = slices.Delete(parent.Children, sep+1, sep+2)
+
+	if err := tree.writeNode(left); err != nil {
+		return err
 	}
+	if err := tree.writeNode(parent); err != nil {
+		return err
+	}
+	return tree.Store.FreePage(right.Page.Header.PageID)
+}
 
-	foundIndex := -1
-	for i, k := range Node.Keys {
-		if k == key {
-			foundIndex = i
-			break
+// borrowFromLeft moves the last entry of left to the front of right and updates the
+// separator between them.
+func (tree *BPlusTree) borrowFromLeft(parent *BTreeNode, sep int, left *BTreeNode, right *BTreeNode) {
+	last := len(left.Keys) - 1
+	if left.IsLeaf {
+		right.Keys = slices.Insert(right.Keys, 0, left.Keys[last])
+		right.Pointers = slices.Insert(right.Pointers, 0, left.Pointers[last])
+		left.Keys = left.Keys[:last]
+		left.Pointers = left.Pointers[:last]
+		parent.Keys[sep] = right.Keys[0]
+		return
+	}
+	right.Keys = slices.Insert(right.Keys, 0, parent.Keys[sep])
+	right.Children = slices.Insert(right.Children, 0, left.Children[last+1])
+	parent.Keys[sep] = left.Keys[last]
+	left.Keys = left.Keys[:last]
+	left.Children = left.Children[:last+1]
+}
+
+// borrowFromRight moves the first entry of right to the end of left and updates the
+// separator between them.
+func (tree *BPlusTree) borrowFromRight(parent *BTreeNode, sep int, left *BTreeNode, right *BTreeNode) {
+	if left.IsLeaf {
+		left.Keys = append(left.Keys, right.Keys[0])
+		left.Pointers = append(left.Pointers, right.Pointers[0])
+		right.Keys = slices.Delete(right.Keys, 0, 1)
+		right.Pointers = slices.Delete(right.Pointers, 0, 1)
+		parent.Keys[sep] = right.Keys[0]
+		return
+	}
+	left.Keys = append(left.Keys, parent.Keys[sep])
+	left.Children = append(left.Children, right.Children[0])
+	parent.Keys[sep] = right.Keys[0]
+	right.Keys = slices.Delete(right.Keys, 0, 1)
+	right.Children = slices.Delete(right.Children, 0, 1)
+}
+
+// isOverfull reports whether node must be split. With a fixed order that is a key
+// count; otherwise a node is full once it leaves less than one maximum-size key of
+// room in its page, so that swapping a separator key can never overflow it.
+func (tree *BPlusTree) isOverfull(node *BTreeNode) bool {
+	if tree.Order > 0 {
+		return len(node.Keys) > tree.Order-1
+	}
+	return tree.nodeSize(node) > tree.Store.PageSize()-tree.maxKeySize()
+}
+
+// canAbsorbInsert reports whether node stays within its limit after gaining key,
+// or the largest separator a child split could push up, so that its parent will
+// not change.
+func (tree *BPlusTree) canAbsorbInsert(node *BTreeNode, key string) bool {
+	Grown := node.clone()
+	if Grown.IsLeaf {
+		Grown.Keys = append(Grown.Keys, key)
+		Grown.Pointers = append(Grown.Pointers, fmt.Sprintf("%d:%d", uint32(math.MaxUint32), uint32(math.MaxUint32)))
+	} else {
+		Grown.Keys = append(Grown.Keys, strings.Repeat("x", tree.maxKeySize()))
+		Grown.Children = append(Grown.Children, math.MaxUint32)
+	}
+	return !tree.isOverfull(Grown)
+}
+
+// canAbsorbDelete reports whether deleting key below node cannot leave node needing
+// its parent to rebalance it. A leaf is measured without key itself. An internal node
+// is measured without its longest separator and that separator's child, the most a
+// merge below it can take away; a borrow below only replaces a separator, which
+// takes away less. The root never rebalances, but an internal root with a single
+// key collapses when it loses it.
+func (tree *BPlusTree) canAbsorbDelete(node *BTreeNode, key string, isRoot bool) bool {
+	if isRoot {
+		return node.IsLeaf || len(node.Keys) > 1
+	}
+	if len(node.Keys) < 2 {
+		return false
+	}
+	Rest := node.clone()
+	if Rest.IsLeaf {
+		i := sort.SearchStrings(Rest.Keys, key)
+		if i == len(Rest.Keys) || Rest.Keys[i] != key {
+			return true // Nothing to delete
+		}
+		Rest.Keys = slices.Delete(Rest.Keys, i, i+1)
+		Rest.Pointers = slices.Delete(Rest.Pointers, i, i+1)
+	} else {
+		var Longest int = 0
+		for i, Key := range Rest.Keys {
+			if len(Key) > len(Rest.Keys[Longest]) {
+				Longest = i
+			}
 		}
+		Rest.Keys = slices.Delete(Rest.Keys, Longest, Longest+1)
+		Rest.Children = slices.Delete(Rest.Children, Longest+1, Longest+2)
 	}
+	return !tree.isUnderfull(Rest)
+}
 
-	if foundIndex != -1 {
-		Node.Keys = append(Node.Keys[:foundIndex], Node.Keys[foundIndex+1:]...)
-		Node.Pointers = append(Node.Pointers[:foundIndex], Node.Pointers[foundIndex+1:]...)
-		return tree.writeNode(Node)
+// isUnderfull reports whether a non-root node should be rebalanced. With a fixed order
+// a split leaves at least this many keys on each side and two nodes at the limit always
+// fit into one; otherwise a node is underfull below a quarter of the page.
+func (tree *BPlusTree) isUnderfull(node *BTreeNode) bool {
+	if tree.Order > 0 {
+		maxKeys := tree.Order - 1
+		if node.IsLeaf {
+			return len(node.Keys) < (maxKeys+1)/2
+		}
+		return len(node.Keys) < maxKeys/2
 	}
+	return len(node.Keys) == 0 || tree.nodeSize(node) < tree.Store.PageSize()/4
+}
 
-	return fmt.Errorf("key not found for deletion")
+// canSpare reports whether node can give up its first or last entry to a sibling
+// without becoming underfull itself.
+func (tree *BPlusTree) canSpare(node *BTreeNode, first bool) bool {
+	if len(node.Keys) < 2 {
+		return false
+	}
+	Rest := node.clone()
+	if first {
+		Rest.Keys = Rest.Keys[1:]
+		if Rest.IsLeaf {
+			Rest.Pointers = Rest.Pointers[1:]
+		} else {
+			Rest.Children = Rest.Children[1:]
+		}
+	} else {
+		Rest.Keys = Rest.Keys[:len(Rest.Keys)-1]
+		if Rest.IsLeaf {
+			Rest.Pointers = Rest.Pointers[:len(Rest.Pointers)-1]
+		} else {
+			Rest.Children = Rest.Children[:len(Rest.Children)-1]
+		}
+	}
+	return !tree.isUnderfull(Rest)
+}
+
+// checkKey returns an error if key cannot be inserted into the tree.
+func (tree *BPlusTree) checkKey(key string) error {
+	if key == "" {
+		// An empty key cannot be told apart from an empty node on disk.
+		return fmt.Errorf("empty keys cannot be indexed")
+	}
+	if KeySize := encodedKeySize(key); KeySize > tree.maxKeySize() {
+		return fmt.Errorf("key of %d encoded bytes exceeds the index limit of %d bytes", KeySize, tree.maxKeySize())
+	}
+	return nil
+}
+
+// maxKeySize is the largest key the tree accepts. A page-fill tree takes keys up to an
+// eighth of a page, which guarantees that every node can hold several keys. A tree of
+// fixed order splits by key count alone, so it only takes keys small enough that a
+// node holding Order-1 of them still fits in its page.
+func (tree *BPlusTree) maxKeySize() int {
+	if tree.Order > 0 {
+		return tree.keyLimit
+	}
+	return tree.Store.PageSize() / 8
+}
+
+// minKeyLimit is the smallest key limit a new tree of fixed order may have. Orders
+// that leave less room per key than this are rejected.
+const minKeyLimit = 16
+
+// checkOrder sets the key limit of a new tree and returns an error if its order
+// leaves too little room in a page for each key.
+func (tree *BPlusTree) checkOrder() error {
+	tree.keyLimit = tree.fixedKeyLimit()
+	if tree.Order > 0 && tree.keyLimit < minKeyLimit {
+		return fmt.Errorf("B+ tree order %d does not fit in %d-byte pages: nodes could only hold keys of %d bytes", tree.Order, tree.Store.PageSize(), tree.keyLimit)
+	}
+	return nil
+}
+
+// fixedKeyLimit returns the largest key size for which a full leaf and a full
+// internal node of a fixed-order tree both fit in a page, capped at the page-fill
+// limit. It returns 0 for a page-fill tree, or if not even empty keys fit.
+func (tree *BPlusTree) fixedKeyLimit() int {
+	if tree.Order == 0 {
+		return 0
+	}
+	var Low, High int = -1, tree.Store.PageSize() / 8
+	for Low < High {
+		var Middle int = (Low + High + 1) / 2
+		if tree.fullNodesFit(Middle) {
+			Low = Middle
+		} else {
+			High = Middle - 1
+		}
+	}
+	return max(Low, 0)
+}
+
+// fullNodesFit reports whether a leaf and an internal node holding Order-1 keys of
+// KeySize bytes, with the longest possible pointers, fit in a page.
+func (tree *BPlusTree) fullNodesFit(KeySize int) bool {
+	var Header PageHeader = PageHeader{PageID: math.MaxUint32, PageType: "Index", PageLSN: math.MaxUint64}
+	var Leaf *BTreeNode = &BTreeNode{Page: &Page{Header: Header}, IsLeaf: true, NextLeaf: math.MaxUint32}
+	var Internal *BTreeNode = &BTreeNode{Page: &Page{Header: Header}, Children: []uint{math.MaxUint32}}
+	var Key string = strings.Repeat("x", KeySize)
+	for i := 0; i < tree.Order-1; i++ {
+		Leaf.Keys = append(Leaf.Keys, Key)
+		Leaf.Pointers = append(Leaf.Pointers, fmt.Sprintf("%d:%d", uint32(math.MaxUint32), uint32(math.MaxUint32)))
+		Internal.Keys = append(Internal.Keys, Key)
+		Internal.Children = append(Internal.Children, math.MaxUint32)
+	}
+	var PageSize int = tree.Store.PageSize()
+	return tree.nodeSize(Leaf) <= PageSize && tree.nodeSize(Internal) <= PageSize
+}
+
+// encodedKeySize returns how many bytes key takes up in a node's page once it has
+// been escaped for the key list and for the page line.
+func encodedKeySize(key string) int {
+	return len(escapeValue(escapeValue(key, string(ListSeparator)), ""))
+}
+
+// nodeSize returns the size of the page node would be written to.
+func (tree *BPlusTree) nodeSize(node *BTreeNode) int {
+	var Page *Page = &Page{
+		Header: node.Page.Header,
+		Data:   make(map[string]string),
+	}
+	encodeNode(node, Page)
+	return Page.Size()
+}
+
+// clone returns a copy of node that can be modified without affecting the original.
+// Both still refer to the same page.
+func (node *BTreeNode) clone() *BTreeNode {
+	return &BTreeNode{
+		Page:     node.Page,
+		IsLeaf:   node.IsLeaf,
+		Keys:     slices.Clone(node.Keys),
+		Children: slices.Clone(node.Children),
+		Pointers: slices.Clone(node.Pointers),
+		NextLeaf: node.NextLeaf,
+	}
 }
 
 // readNode deserializes a page into a BTreeNode.
 func (tree *BPlusTree) readNode(pageID uint) (*BTreeNode, error) {
-	Page, err := tree.FileHandler.ReadPage(pageID)
+	Page, err := tree.Store.ReadPage(pageID)
 	if err != nil {
 		return nil, err
 	}
@@ -145,20 +685,45 @@ func (tree *BPlusTree) readNode(pageID uint) (*BTreeNode, error) {
 	}
 	Node.IsLeaf, _ = strconv.ParseBool(Page.Data["IsLeaf"])
 	if keys, ok := Page.Data["Keys"]; ok && keys != "" {
-		Node.Keys = strings.Split(keys, ",")
+		Node.Keys = splitEscaped(keys, ListSeparator)
 	}
 	if pointers, ok := Page.Data["Pointers"]; ok && pointers != "" {
-		Node.Pointers = strings.Split(pointers, ",")
+		Node.Pointers = splitEscaped(pointers, ListSeparator)
+	}
+	if children, ok := Page.Data["Children"]; ok && children != "" {
+		for _, child := range splitEscaped(children, ListSeparator) {
+			childID, err := strconv.ParseUint(child, 10, 32)
+			if err != nil {
+				return nil, fmt.Errorf("corrupt child pointer '%s' on page %d", child, pageID)
+			}
+			Node.Children = append(Node.Children, uint(childID))
+		}
+	}
+	if nextLeaf, ok := Page.Data["NextLeaf"]; ok && nextLeaf != "" {
+		nextLeafID, err := strconv.ParseUint(nextLeaf, 10, 32)
+		if err != nil {
+			return nil, fmt.Errorf("corrupt next leaf pointer '%s' on page %d", nextLeaf, pageID)
+		}
+		Node.NextLeaf = uint(nextLeafID)
 	}
-	// Add children deserialization for internal nodes here...
 	return Node, nil
 }
 
 // writeNode serializes a BTreeNode back into its page and writes to disk.
 func (tree *BPlusTree) writeNode(node *BTreeNode) error {
-	node.Page.Data["IsLeaf"] = strconv.FormatBool(node.IsLeaf)
-	node.Page.Data["Keys"] = strings.Join(node.Keys, ",")
-	node.Page.Data["Pointers"] = strings.Join(node.Pointers, ",")
-	// Add children serialization for internal nodes here...
-	return tree.FileHandler.WritePage(node.Page)
+	encodeNode(node, node.Page)
+	return tree.Store.WritePage(node.Page)
+}
+
+// encodeNode stores the node's fields in the data section of page.
+func encodeNode(node *BTreeNode, page *Page) {
+	page.Data["IsLeaf"] = strconv.FormatBool(node.IsLeaf)
+	page.Data["Keys"] = joinEscaped(node.Keys, ListSeparator)
+	page.Data["Pointers"] = joinEscaped(node.Pointers, ListSeparator)
+	children := make([]string, len(node.Children))
+	for i, child := range node.Children {
+		children[i] = strconv.FormatUint(uint64(child), 10)
+	}
+	page.Data["Children"] = joinEscaped(children, ListSeparator)
+	page.Data["NextLeaf"] = strconv.FormatUint(uint64(node.NextLeaf), 10)
 }
@@ -0,0 +1,158 @@
+package storage
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestBPlusTreeInsertSplitsAndKeepsOrder(t *testing.T) {
+	Handler, err := NewTextFileHandler(testPath(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	Tree, err := NewBPlusTree(Handler, 4)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 60; i++ {
+		if err := Tree.Insert(fmt.Sprintf("k%03d", (i*37)%60), uint(i+100), 1); err != nil {
+			t.Fatalf("Insert: %v", err)
+		}
+	}
+	if Count := countKeys(t, Tree); Count != 60 {
+		t.Fatalf("tree holds %d keys, want 60", Count)
+	}
+	if Tree.Height < 2 {
+		t.Fatalf("tree of order 4 with 60 keys has height %d", Tree.Height)
+	}
+
+	var Cursor *Cursor = Tree.Cursor()
+	var i int = 0
+	for Valid := Cursor.First(); Valid; Valid = Cursor.Next() {
+		if Cursor.Key() != fmt.Sprintf("k%03d", i) {
+			t.Fatalf("key %d is %q", i, Cursor.Key())
+		}
+		i++
+	}
+	if i != 60 {
+		t.Fatalf("cursor visited %d keys, want 60", i)
+	}
+}
+
+func TestBPlusTreeDeleteRebalances(t *testing.T) {
+	Handler, err := NewTextFileHandler(testPath(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	Tree, err := NewBPlusTree(Handler, 4)
+	if err != nil {
+		t.Fatal(err)
+	}
+	const N = 150
+	for i := 0; i < N; i++ {
+		if err := Tree.Insert(fmt.Sprintf("k%03d", (i*37)%N), uint(i+1), 1); err != nil {
+			t.Fatalf("Insert: %v", err)
+		}
+	}
+	for i := 0; i < N; i++ {
+		var Key string = fmt.Sprintf("k%03d", (i*53)%N)
+		if err := Tree.Delete(Key); err != nil {
+			t.Fatalf("Delete %s: %v", Key, err)
+		}
+		if Count := countKeys(t, Tree); Count != N-i-1 {
+			t.Fatalf("after %d deletes the tree holds %d keys", i+1, Count)
+		}
+		if _, _, err := Tree.Find(Key); !errors.Is(err, ErrKeyNotFound) {
+			t.Fatalf("Find %s after Delete: %v", Key, err)
+		}
+	}
+	if err := Tree.Delete("zz"); !errors.Is(err, ErrKeyNotFound) {
+		t.Fatalf("Delete of a missing key: %v", err)
+	}
+
+	// Refilling the tree reuses the freed node pages before growing the file.
+	var PageCount uint = Handler.PageCount()
+	for i := 0; i < N; i++ {
+		if err := Tree.Insert(fmt.Sprintf("k%03d", i), 1, 1); err != nil {
+			t.Fatalf("Insert: %v", err)
+		}
+	}
+	if Handler.PageCount() != PageCount && len(Handler.DeallocatedPages) > 0 {
+		t.Fatalf("page count grew from %d to %d with %d pages still free", PageCount, Handler.PageCount(), len(Handler.DeallocatedPages))
+	}
+}
+
+func TestBPlusTreeFillsPagesByBytes(t *testing.T) {
+	Handler, err := NewTextFileHandler(testPath(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	Handler.pageSize = 512
+	Tree, err := NewBPlusTree(Handler, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	const N = 1500
+	for i := 0; i < N; i++ {
+		if err := Tree.Insert(fmt.Sprintf("key-%05d", (i*37)%N), uint(i+1), 1); err != nil {
+			t.Fatalf("Insert: %v", err)
+		}
+	}
+	if Count := countKeys(t, Tree); Count != N {
+		t.Fatalf("tree holds %d keys, want %d", Count, N)
+	}
+	for i := 0; i < N-10; i++ {
+		if err := Tree.Delete(fmt.Sprintf("key-%05d", (i*53)%N)); err != nil {
+			t.Fatalf("Delete: %v", err)
+		}
+	}
+	if Count := countKeys(t, Tree); Count != 10 {
+		t.Fatalf("tree holds %d keys, want 10", Count)
+	}
+}
+
+func TestBPlusTreeRejectsBadKeys(t *testing.T) {
+	Tree, err := NewBPlusTree(NewMemoryPageStore(DefaultPageSize), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := Tree.Insert("", 1, 1); err == nil {
+		t.Fatal("Insert accepted an empty key")
+	}
+	if err := Tree.Insert(strings.Repeat("k", 600), 1, 1); err == nil {
+		t.Fatal("Insert accepted a key larger than an eighth of a page")
+	}
+	if Tree.KeyCount != 0 {
+		t.Fatalf("KeyCount is %d after rejected inserts", Tree.KeyCount)
+	}
+}
+
+func TestBPlusTreeFixedOrderFitsPage(t *testing.T) {
+	if _, err := OpenInMemory(WithBTreeOrder(500)); err == nil {
+		t.Fatal("OpenInMemory accepted an order whose nodes cannot fit in a page")
+	}
+
+	Tree, err := NewBPlusTree(NewMemoryPageStore(DefaultPageSize), 16)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var Limit int = Tree.maxKeySize()
+	if Limit < minKeyLimit || Limit > DefaultPageSize/8 {
+		t.Fatalf("order 16 allows keys of %d bytes", Limit)
+	}
+	if err := Tree.Insert(strings.Repeat("k", Limit+1), 1, 1); err == nil {
+		t.Fatalf("Insert accepted a key longer than the limit of %d bytes", Limit)
+	}
+	// Full nodes of keys at the limit still fit in their pages.
+	for i := 0; i < 500; i++ {
+		var Key string = fmt.Sprintf("%0*d", Limit, (i*37)%500)
+		if err := Tree.Insert(Key, uint(i+1), 1); err != nil {
+			t.Fatalf("Insert of a %d-byte key: %v", Limit, err)
+		}
+	}
+	if Count := countKeys(t, Tree); Count != 500 {
+		t.Fatalf("tree holds %d keys, want 500", Count)
+	}
+}
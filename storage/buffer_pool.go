@@ -0,0 +1,268 @@
+package storage
+
+import (
+	"container/list"
+	"errors"
+	"fmt"
+	"sync"
+)
+
+// DefaultBufferPoolFrames is the number of pages a database caches unless
+// WithBufferPool says otherwise.
+const DefaultBufferPoolFrames int = 256
+
+// ErrNoFreeFrames is returned when every frame in the buffer pool is pinned.
+var ErrNoFreeFrames = errors.New("buffer pool has no unpinned frames")
+
+// BufferPool caches pages from another PageStore in a fixed number of frames. Pages
+// are parsed once and then served from memory until they are evicted, least recently
+// used first. Writes only mark a frame dirty; dirty pages reach the underlying store
+// when they are evicted, and on Sync and Close.
+//
+// If Log is set, the log is synced up to a page's PageLSN before the page is
+// written back, so that the store never holds a change the log could lose.
+//
+// BufferPool is itself a PageStore, so it can sit between Database and any backend.
+// Callers that want to avoid copying can pin a page with FetchPage and release it
+// with UnpinPage instead of using ReadPage and WritePage.
+type BufferPool struct {
+	Store  PageStore
+	Log    *WriteAheadLog
+	Frames int
+	Hits   uint64
+	Misses uint64
+	Mutex  sync.Mutex
+	frames map[uint]*bufferFrame
+	lru    *list.List // Unpinned frames, least recently used at the front
+}
+
+// bufferFrame holds one cached page.
+type bufferFrame struct {
+	Page     *Page
+	PinCount int
+	Dirty    bool
+	element  *list.Element // Position in lru while unpinned
+}
+
+// NewBufferPool creates a buffer pool with the given number of frames over Store.
+func NewBufferPool(Store PageStore, Frames int) (*BufferPool, error) {
+	if Frames < 1 {
+		return nil, fmt.Errorf("buffer pool needs at least one frame, got %d", Frames)
+	}
+	return &BufferPool{
+		Store:  Store,
+		Frames: Frames,
+		frames: make(map[uint]*bufferFrame, Frames),
+		lru:    list.New(),
+	}, nil
+}
+
+// FetchPage pins a page in the pool and returns it. The page stays in memory until
+// it is unpinned as many times as it was fetched. Changes made to the returned page
+// must be reported through UnpinPage.
+func (self *BufferPool) FetchPage(PageID uint) (*Page, error) {
+	self.Mutex.Lock()
+	defer self.Mutex.Unlock()
+
+	Frame, err := self.fetch(PageID)
+	if err != nil {
+		return nil, err
+	}
+	self.pin(Frame)
+	return Frame.Page, nil
+}
+
+// UnpinPage releases a pin taken by FetchPage. Dirty marks the page as modified so
+// that it is written back before its frame is reused.
+func (self *BufferPool) UnpinPage(PageID uint, Dirty bool) error {
+	self.Mutex.Lock()
+	defer self.Mutex.Unlock()
+
+	Frame, Cached := self.frames[PageID]
+	if !Cached || Frame.PinCount == 0 {
+		return fmt.Errorf("page %d is not pinned", PageID)
+	}
+	Frame.Dirty = Frame.Dirty || Dirty
+	self.unpin(Frame)
+	return nil
+}
+
+// ReadPage returns a copy of a page, reading it into the pool if it is not cached.
+func (self *BufferPool) ReadPage(PageID uint) (*Page, error) {
+	self.Mutex.Lock()
+	defer self.Mutex.Unlock()
+
+	Frame, err := self.fetch(PageID)
+	if err != nil {
+		return nil, err
+	}
+	self.touch(Frame)
+	return Frame.Page.clone(), nil
+}
+
+// WritePage caches a copy of the page and marks it dirty.
+// It returns ErrPageOverflow if the page is larger than PageSize.
+func (self *BufferPool) WritePage(Page *Page) error {
+	if Size := Page.Size(); Size > self.Store.PageSize() {
+		return fmt.Errorf("%w: page %d is %d bytes, limit is %d", ErrPageOverflow, Page.Header.PageID, Size, self.Store.PageSize())
+	}
+
+	self.Mutex.Lock()
+	defer self.Mutex.Unlock()
+
+	if Frame, Cached := self.frames[Page.Header.PageID]; Cached {
+		Frame.Page = Page.clone()
+		Frame.Dirty = true
+		self.touch(Frame)
+		return nil
+	}
+
+	if err := self.makeRoom(); err != nil {
+		return err
+	}
+	var Frame *bufferFrame = &bufferFrame{Page: Page.clone(), Dirty: true}
+	self.frames[Page.Header.PageID] = Frame
+	Frame.element = self.lru.PushBack(Frame)
+	return nil
+}
+
+// AllocatePage reserves a page ID in the underlying store.
+func (self *BufferPool) AllocatePage() (*Page, error) {
+	return self.Store.AllocatePage()
+}
+
+// FreePage drops any cached copy of the page and frees it in the underlying store.
+func (self *BufferPool) FreePage(PageID uint) error {
+	self.Mutex.Lock()
+	if Frame, Cached := self.frames[PageID]; Cached {
+		if Frame.PinCount > 0 {
+			self.Mutex.Unlock()
+			return fmt.Errorf("cannot free pinned page %d", PageID)
+		}
+		self.lru.Remove(Frame.element)
+		delete(self.frames, PageID)
+	}
+	self.Mutex.Unlock()
+	return self.Store.FreePage(PageID)
+}
+
+// PageSize returns the size of a page in bytes.
+func (self *BufferPool) PageSize() int {
+	return self.Store.PageSize()
+}
+
+// PageCount returns the highest PageID allocated so far.
+func (self *BufferPool) PageCount() uint {
+	return self.Store.PageCount()
+}
+
+// Flush writes every dirty page back to the underlying store.
+func (self *BufferPool) Flush() error {
+	self.Mutex.Lock()
+	defer self.Mutex.Unlock()
+
+	for _, Frame := range self.frames {
+		if err := self.writeBack(Frame); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Sync flushes dirty pages and syncs the underlying store.
+func (self *BufferPool) Sync() error {
+	if err := self.Flush(); err != nil {
+		return err
+	}
+	return self.Store.Sync()
+}
+
+// Close flushes dirty pages and closes the underlying store.
+func (self *BufferPool) Close() error {
+	if err := self.Flush(); err != nil {
+		self.Store.Close()
+		return err
+	}
+	return self.Store.Close()
+}
+
+// fetch returns the frame holding PageID, reading the page from the underlying
+// store into a free or evicted frame on a miss.
+func (self *BufferPool) fetch(PageID uint) (*bufferFrame, error) {
+	if Frame, Cached := self.frames[PageID]; Cached {
+		self.Hits++
+		return Frame, nil
+	}
+	self.Misses++
+
+	if err := self.makeRoom(); err != nil {
+		return nil, err
+	}
+	Page, err := self.Store.ReadPage(PageID)
+	if err != nil {
+		return nil, err
+	}
+	var Frame *bufferFrame = &bufferFrame{Page: Page}
+	self.frames[PageID] = Frame
+	Frame.element = self.lru.PushBack(Frame)
+	return Frame, nil
+}
+
+// makeRoom evicts the least recently used unpinned page if every frame is in use.
+func (self *BufferPool) makeRoom() error {
+	if len(self.frames) < self.Frames {
+		return nil
+	}
+	var Oldest *list.Element = self.lru.Front()
+	if Oldest == nil {
+		return ErrNoFreeFrames
+	}
+	var Victim *bufferFrame = Oldest.Value.(*bufferFrame)
+	if err := self.writeBack(Victim); err != nil {
+		return err
+	}
+	self.lru.Remove(Oldest)
+	delete(self.frames, Victim.Page.Header.PageID)
+	return nil
+}
+
+// writeBack writes a dirty frame to the underlying store.
+func (self *BufferPool) writeBack(Frame *bufferFrame) error {
+	if !Frame.Dirty {
+		return nil
+	}
+	if self.Log != nil {
+		if err := self.Log.Flush(Frame.Page.Header.PageLSN); err != nil {
+			return err
+		}
+	}
+	if err := self.Store.WritePage(Frame.Page); err != nil {
+		return err
+	}
+	Frame.Dirty = false
+	return nil
+}
+
+// pin takes a frame off the LRU list so that it cannot be evicted.
+func (self *BufferPool) pin(Frame *bufferFrame) {
+	if Frame.PinCount == 0 {
+		self.lru.Remove(Frame.element)
+		Frame.element = nil
+	}
+	Frame.PinCount++
+}
+
+// unpin puts a frame back on the LRU list once its last pin is released.
+func (self *BufferPool) unpin(Frame *bufferFrame) {
+	Frame.PinCount--
+	if Frame.PinCount == 0 {
+		Frame.element = self.lru.PushBack(Frame)
+	}
+}
+
+// touch marks an unpinned frame as the most recently used.
+func (self *BufferPool) touch(Frame *bufferFrame) {
+	if Frame.PinCount == 0 {
+		self.lru.MoveToBack(Frame.element)
+	}
+}
@@ -0,0 +1,57 @@
+package storage
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestBufferPoolEvictsAndWritesBack(t *testing.T) {
+	var Path string = testPath(t)
+	db := openTest(t, Path, WithBufferPool(4))
+	for i := 0; i < 500; i++ {
+		if err := db.Insert(fmt.Sprintf("k%04d", i), fmt.Sprint(i)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	Pool, IsPool := db.Log.Store.(*BufferPool)
+	if !IsPool {
+		t.Fatalf("database store is %T, not a buffer pool", db.Log.Store)
+	}
+	for i := 0; i < 500; i++ {
+		if _, err := db.Get(fmt.Sprintf("k%04d", i)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if Pool.Hits == 0 || Pool.Misses == 0 {
+		t.Fatalf("a 4-frame pool over %d pages had %d hits and %d misses", db.Store.PageCount(), Pool.Hits, Pool.Misses)
+	}
+
+	Page, err := Pool.FetchPage(1)
+	if err != nil || Page == nil {
+		t.Fatalf("FetchPage(1) = %v, %v", Page, err)
+	}
+	if err := Pool.UnpinPage(1, false); err != nil {
+		t.Fatal(err)
+	}
+	if err := Pool.UnpinPage(1, false); err == nil {
+		t.Fatal("UnpinPage of an unpinned page succeeded")
+	}
+	if err := db.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	db = openTest(t, Path)
+	defer db.Close()
+	for i := 0; i < 500; i++ {
+		Record, err := db.Get(fmt.Sprintf("k%04d", i))
+		if err != nil || Record == nil || Record.Fields[1] != fmt.Sprint(i) {
+			t.Fatalf("Get k%04d = %v, %v", i, Record, err)
+		}
+	}
+}
+
+func TestNewBufferPoolNeedsAFrame(t *testing.T) {
+	if _, err := NewBufferPool(NewMemoryPageStore(DefaultPageSize), 0); err == nil {
+		t.Fatal("NewBufferPool accepted zero frames")
+	}
+}
@@ -0,0 +1,254 @@
+package storage
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Catalog records the tables of a database and their secondary indexes. It lives
+// in its own "Catalog" page, which the metadata page points to. Each table has a
+// "Table-<name>" entry holding the metadata page of its primary-key index, the
+// primary key and the name and type of each column, written as
+// "MetaPageID|PrimaryKey|Name|Type|Name|Type...". Each secondary index has an
+// "Index-<table>|<column>" entry written as "MetaPageID|unique" or "MetaPageID|".
+type Catalog struct {
+	PageID uint
+	Tables map[string]*Table
+	Mutex  sync.RWMutex // Guards Tables, which are looked up without the write lock
+	db     *Database
+}
+
+// openCatalog loads the catalog of db, creating its page and recording it in the
+// metadata page if the database does not have one yet.
+func openCatalog(db *Database) (*Catalog, error) {
+	var Catalog *Catalog = &Catalog{
+		Tables: make(map[string]*Table),
+		db:     db,
+	}
+
+	MetaPage, err := db.Store.ReadPage(MetaPageID)
+	if err != nil {
+		return nil, err
+	}
+	if PageIDString, KeyExists := MetaPage.Data["CatalogPageID"]; KeyExists {
+		PageID, err := strconv.ParseUint(PageIDString, 10, 32)
+		if err != nil {
+			return nil, fmt.Errorf("corrupt catalog page pointer '%s'", PageIDString)
+		}
+		Catalog.PageID = uint(PageID)
+		return Catalog, Catalog.load()
+	}
+
+	CatalogPage, err := db.Store.AllocatePage()
+	if err != nil {
+		return nil, err
+	}
+	Catalog.PageID = CatalogPage.Header.PageID
+	if err := Catalog.save(); err != nil {
+		return nil, err
+	}
+
+	MetaPage.Data["CatalogPageID"] = strconv.FormatUint(uint64(Catalog.PageID), 10)
+	if err := db.Store.WritePage(MetaPage); err != nil {
+		return nil, err
+	}
+	return Catalog, nil
+}
+
+// table returns the named table, or nil if there is no such table.
+func (self *Catalog) table(Name string) *Table {
+	self.Mutex.RLock()
+	defer self.Mutex.RUnlock()
+	return self.Tables[Name]
+}
+
+// add records a new table and persists the catalog.
+func (self *Catalog) add(Table *Table) error {
+	self.Mutex.Lock()
+	defer self.Mutex.Unlock()
+	self.Tables[Table.Name] = Table
+	if err := self.save(); err != nil {
+		delete(self.Tables, Table.Name)
+		return err
+	}
+	return nil
+}
+
+// addIndex records a new secondary index of a table and persists the catalog.
+func (self *Catalog) addIndex(Table *Table, Index *SecondaryIndex) error {
+	self.Mutex.Lock()
+	defer self.Mutex.Unlock()
+	Table.Indexes[Index.Column] = Index
+	if err := self.save(); err != nil {
+		delete(Table.Indexes, Index.Column)
+		return err
+	}
+	return nil
+}
+
+// load parses the catalog from its page. Tables and indexes that were already open
+// are kept, with their tree state reread from its metadata page.
+func (self *Catalog) load() error {
+	Page, err := self.db.Store.ReadPage(self.PageID)
+	if err != nil {
+		return err
+	}
+	if Page.Header.PageType != "Catalog" {
+		return fmt.Errorf("page %d is a %s page, expected the catalog", self.PageID, Page.Header.PageType)
+	}
+
+	self.Mutex.Lock()
+	defer self.Mutex.Unlock()
+	var Tables map[string]*Table = make(map[string]*Table, len(Page.Data))
+	var Indexes map[string]map[string]*SecondaryIndex = make(map[string]map[string]*SecondaryIndex)
+	for Key, Entry := range Page.Data {
+		Name, IsTable := strings.CutPrefix(Key, "Table-")
+		if !IsTable {
+			continue
+		}
+		MetaPageID, Schema, err := parseCatalogEntry(Entry)
+		if err != nil {
+			return fmt.Errorf("corrupt catalog entry for table '%s': %w", Name, err)
+		}
+		var Open *Table = self.Tables[Name]
+		if Open != nil && Open.Index.MetaPageID == MetaPageID {
+			if _, err := self.reopenTree(Open.Index, MetaPageID); err != nil {
+				return err
+			}
+		} else {
+			Index, err := self.reopenTree(nil, MetaPageID)
+			if err != nil {
+				return err
+			}
+			Open = &Table{Name: Name, Schema: Schema, Index: Index, db: self.db}
+		}
+		Tables[Name] = Open
+		Indexes[Name] = make(map[string]*SecondaryIndex)
+	}
+
+	for Key, Entry := range Page.Data {
+		Names, IsIndex := strings.CutPrefix(Key, "Index-")
+		if !IsIndex {
+			continue
+		}
+		var Items []string = splitEscaped(Names, FieldSeparator)
+		if len(Items) != 2 {
+			return fmt.Errorf("corrupt catalog: invalid index name '%s'", Names)
+		}
+		var TableName, Column string = Items[0], Items[1]
+		var Table *Table = Tables[TableName]
+		if Table == nil || Table.Schema.column(Column) == -1 {
+			return fmt.Errorf("corrupt catalog: index on unknown column '%s' of table '%s'", Column, TableName)
+		}
+		MetaPageID, Unique, err := parseIndexEntry(Entry)
+		if err != nil {
+			return fmt.Errorf("corrupt catalog entry for index on '%s' of table '%s': %w", Column, TableName, err)
+		}
+		var OldIndex *SecondaryIndex = Table.Indexes[Column]
+		var OldTree *BPlusTree
+		if OldIndex != nil && OldIndex.Tree.MetaPageID == MetaPageID {
+			OldTree = OldIndex.Tree
+		}
+		Tree, err := self.reopenTree(OldTree, MetaPageID)
+		if err != nil {
+			return err
+		}
+		Indexes[TableName][Column] = &SecondaryIndex{Column: Column, Unique: Unique, Tree: Tree}
+	}
+
+	for Name, Table := range Tables {
+		Table.Indexes = Indexes[Name]
+	}
+	self.Tables = Tables
+	return nil
+}
+
+// reopenTree rereads the state of an open tree from its metadata page, or opens
+// the tree on MetaPageID if Tree is nil.
+func (self *Catalog) reopenTree(Tree *BPlusTree, MetaPageID uint) (*BPlusTree, error) {
+	if Tree == nil {
+		return openTree(self.db.Store, MetaPageID)
+	}
+	MetaPage, err := self.db.Store.ReadPage(MetaPageID)
+	if err != nil {
+		return nil, err
+	}
+	return Tree, Tree.loadMeta(MetaPage)
+}
+
+// save writes the catalog to its page. The caller holds Mutex or has not shared the
+// catalog yet.
+func (self *Catalog) save() error {
+	var Page *Page = &Page{
+		Header: PageHeader{PageID: self.PageID, PageType: "Catalog"},
+		Data:   make(map[string]string, len(self.Tables)),
+	}
+	for Name, Table := range self.Tables {
+		Page.Data["Table-"+Name] = formatCatalogEntry(Table)
+		for Column, Index := range Table.Indexes {
+			Page.Data["Index-"+joinEscaped([]string{Name, Column}, FieldSeparator)] = formatIndexEntry(Index)
+		}
+	}
+	if Page.Size() > self.db.Store.PageSize() {
+		return fmt.Errorf("%w: the catalog has no room for more tables or indexes", ErrPageFull)
+	}
+	return self.db.Store.WritePage(Page)
+}
+
+// formatCatalogEntry renders the catalog entry of a table.
+func formatCatalogEntry(Table *Table) string {
+	var Items []string = []string{
+		strconv.FormatUint(uint64(Table.Index.MetaPageID), 10),
+		Table.Schema.PrimaryKey,
+	}
+	for _, Column := range Table.Schema.Columns {
+		Items = append(Items, Column.Name, Column.Type.String())
+	}
+	return joinEscaped(Items, FieldSeparator)
+}
+
+// formatIndexEntry renders the catalog entry of a secondary index.
+func formatIndexEntry(Index *SecondaryIndex) string {
+	var Unique string = ""
+	if Index.Unique {
+		Unique = "unique"
+	}
+	return joinEscaped([]string{strconv.FormatUint(uint64(Index.Tree.MetaPageID), 10), Unique}, FieldSeparator)
+}
+
+// parseIndexEntry reverses formatIndexEntry.
+func parseIndexEntry(Entry string) (uint, bool, error) {
+	var Items []string = splitEscaped(Entry, FieldSeparator)
+	if len(Items) != 2 || (Items[1] != "" && Items[1] != "unique") {
+		return 0, false, fmt.Errorf("expected a metadata page and uniqueness")
+	}
+	MetaPageID, err := strconv.ParseUint(Items[0], 10, 32)
+	if err != nil || MetaPageID == 0 {
+		return 0, false, fmt.Errorf("invalid metadata page '%s'", Items[0])
+	}
+	return uint(MetaPageID), Items[1] == "unique", nil
+}
+
+// parseCatalogEntry reverses formatCatalogEntry.
+func parseCatalogEntry(Entry string) (uint, Schema, error) {
+	var Items []string = splitEscaped(Entry, FieldSeparator)
+	if len(Items) < 4 || len(Items)%2 != 0 {
+		return 0, Schema{}, fmt.Errorf("expected a metadata page, a primary key and columns")
+	}
+	MetaPageID, err := strconv.ParseUint(Items[0], 10, 32)
+	if err != nil || MetaPageID == 0 {
+		return 0, Schema{}, fmt.Errorf("invalid metadata page '%s'", Items[0])
+	}
+
+	var Schema Schema = Schema{PrimaryKey: Items[1]}
+	for i := 2; i < len(Items); i += 2 {
+		Type, err := parseColumnType(Items[i+1])
+		if err != nil {
+			return 0, Schema, err
+		}
+		Schema.Columns = append(Schema.Columns, Column{Name: Items[i], Type: Type})
+	}
+	return uint(MetaPageID), Schema, Schema.validate()
+}
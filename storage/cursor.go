@@ -0,0 +1,169 @@
+package storage
+
+import "sort"
+
+// Cursor walks the keys of a BPlusTree in order by following the linked leaves.
+// A cursor is positioned with First, Last or Seek and then moved with Next and Prev.
+// It reads one leaf at a time, so a cursor over a tree that other goroutines are
+// changing can miss keys that move between leaves; scan a snapshot for a
+// consistent view.
+type Cursor struct {
+	Tree  *BPlusTree
+	Leaf  *BTreeNode
+	Index int
+	err   error
+}
+
+// Cursor returns a new, unpositioned cursor over the tree.
+func (tree *BPlusTree) Cursor() *Cursor {
+	return &Cursor{Tree: tree}
+}
+
+// First positions the cursor at the smallest key in the tree.
+func (c *Cursor) First() bool {
+	return c.Seek("")
+}
+
+// Last positions the cursor at the largest key in the tree.
+func (c *Cursor) Last() bool {
+	Node, err := c.Tree.descendShared(lastChild)
+	if err != nil {
+		return c.fail(err)
+	}
+	c.Leaf = Node
+	c.Index = len(Node.Keys)
+	return c.Prev()
+}
+
+// Seek positions the cursor at the first key greater than or equal to key.
+// It returns false if there is no such key.
+func (c *Cursor) Seek(key string) bool {
+	Leaf, err := c.Tree.findLeaf(key)
+	if err != nil {
+		return c.fail(err)
+	}
+	c.Leaf = Leaf
+	c.Index = sort.SearchStrings(Leaf.Keys, key) - 1
+	return c.Next()
+}
+
+// Next moves the cursor to the following key, crossing into the next leaf if needed.
+// It returns false once the cursor runs past the last key.
+func (c *Cursor) Next() bool {
+	if c.Leaf == nil {
+		return false
+	}
+	c.Index++
+	for c.Index >= len(c.Leaf.Keys) {
+		if c.Leaf.NextLeaf == 0 {
+			c.Leaf = nil
+			return false
+		}
+		NextLeaf, err := c.Tree.readShared(c.Leaf.NextLeaf)
+		if err != nil {
+			return c.fail(err)
+		}
+		c.Leaf = NextLeaf
+		c.Index = 0
+	}
+	return true
+}
+
+// Prev moves the cursor to the preceding key. Leaves only link forward, so stepping
+// back into the previous leaf descends the tree again from the root.
+// It returns false once the cursor runs past the first key.
+func (c *Cursor) Prev() bool {
+	if c.Leaf == nil {
+		return false
+	}
+	c.Index--
+	for c.Index < 0 {
+		if len(c.Leaf.Keys) == 0 {
+			c.Leaf = nil
+			return false
+		}
+		PrevLeaf, err := c.Tree.prevLeaf(c.Leaf.Keys[0])
+		if err != nil {
+			return c.fail(err)
+		}
+		if PrevLeaf == nil {
+			c.Leaf = nil
+			return false
+		}
+		c.Leaf = PrevLeaf
+		c.Index = len(PrevLeaf.Keys) - 1
+	}
+	return true
+}
+
+// Valid reports whether the cursor is positioned at a key.
+func (c *Cursor) Valid() bool {
+	return c.Leaf != nil && c.Index >= 0 && c.Index < len(c.Leaf.Keys)
+}
+
+// Key returns the key at the cursor's position.
+func (c *Cursor) Key() string {
+	if !c.Valid() {
+		return ""
+	}
+	return c.Leaf.Keys[c.Index]
+}
+
+// Value returns the data location stored for the key at the cursor's position.
+func (c *Cursor) Value() (uint, uint, error) {
+	if !c.Valid() {
+		return 0, 0, ErrKeyNotFound
+	}
+	return parsePointer(c.Leaf.Pointers[c.Index])
+}
+
+// Err returns the first error the cursor hit while reading pages.
+func (c *Cursor) Err() error {
+	return c.err
+}
+
+// fail invalidates the cursor and records err.
+func (c *Cursor) fail(err error) bool {
+	c.Leaf = nil
+	c.err = err
+	return false
+}
+
+// prevLeaf returns the leaf immediately to the left of the leaf that holds key,
+// or nil if that leaf is the first one.
+func (tree *BPlusTree) prevLeaf(key string) (*BTreeNode, error) {
+	// Remember the closest subtree to the left of the search path.
+	var LeftSubtree uint
+	_, err := tree.descendShared(func(Node *BTreeNode) int {
+		i := childIndexFor(Node.Keys, key)
+		if i > 0 {
+			LeftSubtree = Node.Children[i-1]
+		}
+		return i
+	})
+	if err != nil || LeftSubtree == 0 {
+		return nil, err
+	}
+
+	// The previous leaf is the rightmost leaf of that subtree.
+	tree.latches.lock(LeftSubtree, false)
+	return tree.descendSharedFrom(LeftSubtree, lastChild)
+}
+
+// lastChild picks the rightmost child of an internal node.
+func lastChild(Node *BTreeNode) int {
+	return len(Node.Children) - 1
+}
+
+// PrefixEnd returns the smallest key that sorts after every key starting with prefix,
+// for use as the exclusive end of a prefix scan. It returns "" if there is none.
+func PrefixEnd(prefix string) string {
+	End := []byte(prefix)
+	for i := len(End) - 1; i >= 0; i-- {
+		if End[i] < 0xff {
+			End[i]++
+			return string(End[:i+1])
+		}
+	}
+	return ""
+}
@@ -0,0 +1,76 @@
+package storage
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestCursorWalksBothWays(t *testing.T) {
+	db := openTest(t, testPath(t))
+	defer db.Close()
+	const N = 60
+	for i := 0; i < N; i++ {
+		if err := db.Insert(fmt.Sprintf("k%03d", (i*37)%N), "v"); err != nil {
+			t.Fatal(err)
+		}
+		if err := db.Insert(fmt.Sprintf("j%03d", i), "v"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for i := 0; i < N; i += 3 {
+		if err := db.Delete(fmt.Sprintf("k%03d", i)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var Cursor *Cursor = db.Index.Cursor()
+	var Forward, Backward []string
+	for Valid := Cursor.First(); Valid; Valid = Cursor.Next() {
+		Forward = append(Forward, Cursor.Key())
+	}
+	for Valid := Cursor.Last(); Valid; Valid = Cursor.Prev() {
+		Backward = append([]string{Cursor.Key()}, Backward...)
+	}
+	if err := Cursor.Err(); err != nil {
+		t.Fatal(err)
+	}
+	if len(Forward) != 2*N-N/3 {
+		t.Fatalf("cursor visited %d keys, want %d", len(Forward), 2*N-N/3)
+	}
+	if fmt.Sprint(Forward) != fmt.Sprint(Backward) {
+		t.Fatalf("forward and backward walks differ:\n%v\n%v", Forward, Backward)
+	}
+	for i := 1; i < len(Forward); i++ {
+		if Forward[i-1] >= Forward[i] {
+			t.Fatalf("keys %q and %q are out of order", Forward[i-1], Forward[i])
+		}
+	}
+
+	// Seek lands on the first key at or after its argument.
+	if !Cursor.Seek("k015") || Cursor.Key() != "k016" {
+		t.Fatalf("Seek(k015) landed on %q", Cursor.Key())
+	}
+	if !Cursor.Prev() || Cursor.Key() != "k014" {
+		t.Fatalf("Prev after Seek landed on %q", Cursor.Key())
+	}
+}
+
+func TestScanPrefix(t *testing.T) {
+	db := openTest(t, testPath(t))
+	defer db.Close()
+	insertKeys(t, db, "k", 40, "v")
+	insertKeys(t, db, "j", 10, "v")
+	if err := db.Delete("k007"); err != nil {
+		t.Fatal(err)
+	}
+	Records, err := db.Scan("k", PrefixEnd("k"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(Records) != 39 {
+		t.Fatalf("Scan of prefix k returned %d records, want 39", len(Records))
+	}
+	if PrefixEnd("a\xff") != "b" || PrefixEnd("\xff") != "" {
+		t.Fatalf("PrefixEnd(a\\xff) = %q, PrefixEnd(\\xff) = %q", PrefixEnd("a\xff"), PrefixEnd("\xff"))
+	}
+}
@@ -1,128 +1,302 @@
 package storage
 
 import (
+	"errors"
 	"fmt"
-	"strconv"
-	"strings"
+	"maps"
+	"runtime"
+	"slices"
 	"sync"
 )
 
 // Database provides the main API for interacting with the database.
+//
+// Reads run against snapshots and never wait; each snapshot opens its own copy of
+// the index, so it takes none of Index's latches. Transactions are serialized by
+// Mutex, because the log keeps a single open transaction. Within one, Index's page
+// latches let InsertBatch add independent keys in parallel, and let cursors opened
+// on Index itself run alongside those writers.
 type Database struct {
-	FileHandler *TextFileHandler
-	Index       *BPlusTree
-	Mutex       sync.RWMutex
+	Store     PageStore
+	Log       *LoggedStore    // Log.WAL is nil for databases without a write-ahead log
+	Recovery  *RecoveryReport // What OpenDatabase recovered from the write-ahead log
+	Index     *BPlusTree
+	FreeSpace *FreeSpaceMap
+	Catalog   *Catalog     // Tables created with CreateTable
+	Mutex     sync.RWMutex // Held by writers; readers use snapshots instead
+
+	checkpointLogSize int64
 }
 
 // OpenDatabase initializes and opens the database.
-func OpenDatabase(FilePath string) (*Database, error) {
-	var FileHandler, Error = NewTextFileHandler(FilePath)
+func OpenDatabase(FilePath string, Opts ...Option) (*Database, error) {
+	var Options, OptionsErr = buildOptions(Opts)
+	if OptionsErr != nil {
+		return nil, OptionsErr
+	}
+
+	var Store, Error = openPageStore(FilePath, Options)
 	if Error != nil {
 		return nil, Error
 	}
 
-	var Index, IndexErr = NewBPlusTree(FileHandler)
+	// Replay the write-ahead log before anything reads the index
+	var Recovery, RecoveryErr = Store.Recover()
+	if RecoveryErr != nil {
+		Store.Close()
+		return nil, RecoveryErr
+	}
+
+	var Index, IndexErr = NewBPlusTree(Store, Options.BTreeOrder)
 	if IndexErr != nil {
+		Store.Close()
 		return nil, IndexErr
 	}
 
+	var FreeSpace, FreeSpaceErr = OpenFreeSpaceMap(Store)
+	if FreeSpaceErr != nil {
+		Store.Close()
+		return nil, FreeSpaceErr
+	}
+
 	var DB *Database = &Database{
-		FileHandler: FileHandler,
-		Index:       Index,
+		Store:     Store,
+		Log:       Store,
+		Recovery:  Recovery,
+		Index:     Index,
+		FreeSpace: FreeSpace,
+
+		checkpointLogSize: Options.CheckpointLogSize,
+	}
+
+	var Catalog, CatalogErr = openCatalog(DB)
+	if CatalogErr != nil {
+		Store.Close()
+		return nil, CatalogErr
 	}
+	DB.Catalog = Catalog
 	return DB, nil
 }
 
+// Checkpoint writes every committed change to the database file, records the
+// checkpoint in the file header and empties the write-ahead log. It waits for the
+// open transaction, if any, to finish.
+func (db *Database) Checkpoint() error {
+	db.Mutex.Lock()
+	defer db.Mutex.Unlock()
+	_, err := db.Log.Checkpoint()
+	return err
+}
+
 // Close closes the database resources.
 func (db *Database) Close() error {
-	return db.FileHandler.Close()
+	return db.Store.Close()
 }
 
-// Insert adds a record to the database.
+// Insert adds a record to the database. IDs cannot start with TuplePrefix, which
+// is reserved for the IDs of InsertTuple.
 func (db *Database) Insert(ID string, Data string) error {
+	if err := checkPlainID(ID); err != nil {
+		return err
+	}
 	db.Mutex.Lock()
 	defer db.Mutex.Unlock()
+	return db.logged(func() error {
+		return db.insert(ID, Data)
+	})
+}
 
-	// 1. Check if key already exists
-	if pageID, _, _ := db.Index.Find(ID); pageID != 0 {
-		return fmt.Errorf("record with ID '%s' already exists", ID)
+// insert adds a record to the database. The caller holds the write lock.
+func (db *Database) insert(ID string, Data string) error {
+	// 1. Check that the key can be indexed and does not exist yet, before any
+	// page is written
+	if err := db.Index.checkKey(ID); err != nil {
+		return err
 	}
-
-	// 2. Allocate a new page for the record
-	// (A real DB would try to fit it on an existing data page)
-	DataPage, err := db.FileHandler.AllocatePage()
-	if err != nil {
+	if _, _, err := db.Index.Find(ID); err == nil {
+		return fmt.Errorf("record with ID '%s' already exists", ID)
+	} else if !errors.Is(err, ErrKeyNotFound) {
 		return err
 	}
-	DataPage.Header.PageType = "Data"
 
-	// 3. Add the record to the page
+	// 2. Write the record to a data page with room for it
 	var record = &Record{Fields: []string{ID, Data}}
-	EntryIndex, err := DataPage.AddRecord(record)
+	PageID, EntryIndex, err := db.placeRecord(record)
 	if err != nil {
 		return err
 	}
 
-	// 4. Write the data page to disk
-	if err := db.FileHandler.WritePage(DataPage); err != nil {
-		return err
+	// 3. Insert the key into the B+ Tree index
+	return db.Index.Insert(ID, PageID, EntryIndex)
+}
+
+// InsertBatch adds several records as one change. The records are stored one at a
+// time, and then their IDs are added to the index by one goroutine per core, which
+// the index's page latches let run in parallel. If any record cannot be added, none
+// of them are.
+func (db *Database) InsertBatch(Records map[string]string) error {
+	db.Mutex.Lock()
+	defer db.Mutex.Unlock()
+	return db.logged(func() error {
+		return db.insertBatch(Records)
+	})
+}
+
+// insertBatch adds several records as one change. The caller holds the write lock.
+func (db *Database) insertBatch(Records map[string]string) error {
+	// 1. Check every key before any page is written, in key order so that the
+	// records are placed the same way each time
+	var IDs []string = slices.Sorted(maps.Keys(Records))
+	for _, ID := range IDs {
+		if err := checkPlainID(ID); err != nil {
+			return err
+		}
+		if err := db.Index.checkKey(ID); err != nil {
+			return err
+		}
+		if _, _, err := db.Index.Find(ID); err == nil {
+			return fmt.Errorf("record with ID '%s' already exists", ID)
+		} else if !errors.Is(err, ErrKeyNotFound) {
+			return err
+		}
+	}
+
+	// 2. Write the records to data pages; the free-space map has a single writer
+	var PageIDs []uint = make([]uint, len(IDs))
+	var EntryIndexes []uint = make([]uint, len(IDs))
+	for i, ID := range IDs {
+		PageID, EntryIndex, err := db.placeRecord(&Record{Fields: []string{ID, Records[ID]}})
+		if err != nil {
+			return err
+		}
+		PageIDs[i], EntryIndexes[i] = PageID, EntryIndex
 	}
 
-	// 5. Insert the key into the B+ Tree index
-	return db.Index.Insert(ID, DataPage.Header.PageID, EntryIndex)
+	// 3. Insert the keys into the B+ Tree index in parallel
+	var Workers int = min(runtime.GOMAXPROCS(0), len(IDs))
+	var Errors []error = make([]error, Workers)
+	var Group sync.WaitGroup
+	for w := 0; w < Workers; w++ {
+		Group.Add(1)
+		go func(w int) {
+			defer Group.Done()
+			for i := w; i < len(IDs); i += Workers {
+				if err := db.Index.Insert(IDs[i], PageIDs[i], EntryIndexes[i]); err != nil {
+					Errors[w] = err
+					return
+				}
+			}
+		}(w)
+	}
+	Group.Wait()
+	return errors.Join(Errors...)
 }
 
 // Get retrieves a record by its ID.
+// It reads from a snapshot of the latest commit, so it never waits for writers.
 func (db *Database) Get(ID string) (*Record, error) {
-	db.Mutex.RLock()
-	defer db.Mutex.RUnlock()
+	Snapshot, err := db.BeginRead()
+	if err != nil {
+		return nil, err
+	}
+	defer Snapshot.Close()
+	return Snapshot.Get(ID)
+}
 
+// get retrieves a record by its ID from db's index and store.
+func (db *Database) get(ID string) (*Record, error) {
 	// 1. Find the record's location from the index
 	PageID, EntryIndex, err := db.Index.Find(ID)
+	if errors.Is(err, ErrKeyNotFound) {
+		return nil, nil // Not found
+	}
 	if err != nil {
 		return nil, err
 	}
-	if PageID == 0 {
-		return nil, nil // Not found
-	}
 
 	// 2. Read the data page
-	DataPage, err := db.FileHandler.ReadPage(PageID)
+	DataPage, err := db.Store.ReadPage(PageID)
 	if err != nil {
 		return nil, err
 	}
 
 	// 3. Get the record from the page
-	return DataPage.GetRecord(EntryIndex)
+	return db.readRecord(DataPage, EntryIndex)
+}
+
+// Scan returns the records whose IDs fall in [startKey, endKey), in key order.
+// An empty endKey scans to the end of the index. To list every ID under a prefix,
+// pass the prefix and PrefixEnd(prefix). Plain IDs compare as text, so "user:10"
+// sorts before "user:2"; records stored with InsertTuple scan in the order of their
+// values through ScanTuple and ScanPrefix. Like Get, it reads from a snapshot.
+func (db *Database) Scan(startKey string, endKey string) ([]*Record, error) {
+	Snapshot, err := db.BeginRead()
+	if err != nil {
+		return nil, err
+	}
+	defer Snapshot.Close()
+	return Snapshot.Scan(startKey, endKey)
+}
+
+// scan returns the records whose IDs fall in [startKey, endKey), in key order.
+func (db *Database) scan(startKey string, endKey string) ([]*Record, error) {
+	var Records []*Record
+	var Cursor *Cursor = db.Index.Cursor()
+	for ok := Cursor.Seek(startKey); ok; ok = Cursor.Next() {
+		if endKey != "" && Cursor.Key() >= endKey {
+			break
+		}
+
+		PageID, EntryIndex, err := Cursor.Value()
+		if err != nil {
+			return nil, err
+		}
+		DataPage, err := db.Store.ReadPage(PageID)
+		if err != nil {
+			return nil, err
+		}
+		Record, err := db.readRecord(DataPage, EntryIndex)
+		if err != nil {
+			return nil, err
+		}
+		Records = append(Records, Record)
+	}
+	return Records, Cursor.Err()
 }
 
 // Delete removes a record by its ID.
 func (db *Database) Delete(ID string) error {
 	db.Mutex.Lock()
 	defer db.Mutex.Unlock()
+	return db.logged(func() error {
+		return db.delete(ID)
+	})
+}
 
+// delete removes a record by its ID. The caller holds the write lock.
+func (db *Database) delete(ID string) error {
 	// 1. Find the record's location from the index
 	PageID, EntryIndex, err := db.Index.Find(ID)
+	if errors.Is(err, ErrKeyNotFound) {
+		return fmt.Errorf("record with ID '%s' not found", ID)
+	}
 	if err != nil {
 		return err
 	}
-	if PageID == 0 {
-		return fmt.Errorf("record with ID '%s' not found", ID)
-	}
 
 	// 2. Read the data page
-	DataPage, err := db.FileHandler.ReadPage(PageID)
+	DataPage, err := db.Store.ReadPage(PageID)
 	if err != nil {
 		return err
 	}
 
 	// 3. Delete the record from the page
-	if err := DataPage.DeleteRecord(EntryIndex); err != nil {
+	if err := db.deleteRecord(DataPage, EntryIndex); err != nil {
 		return err
 	}
 
 	// 4. Write the modified data page back to disk
-	if err := db.FileHandler.WritePage(DataPage); err != nil {
+	if err := db.writeDataPage(DataPage); err != nil {
 		return err
 	}
 
@@ -134,24 +308,30 @@ func (db *Database) Delete(ID string) error {
 func (db *Database) Update(ID string, NewData string) error {
 	db.Mutex.Lock()
 	defer db.Mutex.Unlock()
+	return db.logged(func() error {
+		return db.update(ID, NewData)
+	})
+}
 
+// update changes the data for an existing record. The caller holds the write lock.
+func (db *Database) update(ID string, NewData string) error {
 	// 1. Find the record's location
 	PageID, EntryIndex, err := db.Index.Find(ID)
+	if errors.Is(err, ErrKeyNotFound) {
+		return fmt.Errorf("cannot update non-existent record with ID '%s'", ID)
+	}
 	if err != nil {
 		return err
 	}
-	if PageID == 0 {
-		return fmt.Errorf("cannot update non-existent record with ID '%s'", ID)
-	}
 
 	// 2. Read the page
-	DataPage, err := db.FileHandler.ReadPage(PageID)
+	DataPage, err := db.Store.ReadPage(PageID)
 	if err != nil {
 		return err
 	}
 
 	// 3. Get the old record to preserve its structure
-	OldRecord, err := DataPage.GetRecord(EntryIndex)
+	OldRecord, err := db.readRecord(DataPage, EntryIndex)
 	if err != nil {
 		return err
 	}
@@ -159,7 +339,161 @@ func (db *Database) Update(ID string, NewData string) error {
 	// 4. Update the fields and write back
 	// This simple implementation just replaces the second field.
 	OldRecord.Fields[1] = NewData
-	DataPage.Data["Entry-"+strconv.FormatUint(uint64(EntryIndex), 10)] = strings.Join(OldRecord.Fields, "|")
+	if DataPage.OverflowPageID(EntryIndex) == 0 && OldRecord.Size() <= db.maxInlineRecordSize() {
+		err = DataPage.UpdateRecord(EntryIndex, OldRecord, db.Store.PageSize())
+		if err == nil {
+			return db.writeDataPage(DataPage)
+		}
+		if !errors.Is(err, ErrPageFull) {
+			return err
+		}
+	}
+
+	// 5. The record outgrew its slot, so store it again and repoint the index
+	_, _, err = db.moveRecord(db.Index, ID, PageID, EntryIndex, OldRecord)
+	return err
+}
+
+// moveRecord stores record on a page with room for it, removes the old copy at
+// PageID and EntryIndex and repoints Key in Index at the new one, whose location it
+// returns. The new copy may land on the same page, so the page is read again before
+// the old copy is removed.
+func (db *Database) moveRecord(Index *BPlusTree, Key string, PageID uint, EntryIndex uint, record *Record) (uint, uint, error) {
+	NewPageID, NewEntryIndex, err := db.placeRecord(record)
+	if err != nil {
+		return 0, 0, err
+	}
+	DataPage, err := db.Store.ReadPage(PageID)
+	if err != nil {
+		return 0, 0, err
+	}
+	if err := db.deleteRecord(DataPage, EntryIndex); err != nil {
+		return 0, 0, err
+	}
+	if err := db.writeDataPage(DataPage); err != nil {
+		return 0, 0, err
+	}
+	if err := Index.Delete(Key); err != nil {
+		return 0, 0, err
+	}
+	return NewPageID, NewEntryIndex, Index.Insert(Key, NewPageID, NewEntryIndex)
+}
+
+// logged runs a change as one transaction, so that either all of its page writes
+// survive a crash or none do. If the change fails, its writes are undone and the
+// index, free-space map and catalog are reloaded from their pages.
+func (db *Database) logged(Change func() error) error {
+	if err := db.Log.Begin(); err != nil {
+		return err
+	}
+	if err := Change(); err != nil {
+		return errors.Join(err, db.abort())
+	}
+	if err := db.Log.Commit(); err != nil {
+		return errors.Join(err, db.abort())
+	}
+	return db.autoCheckpoint()
+}
+
+// autoCheckpoint checkpoints if the write-ahead log has grown past the configured
+// size. It runs after a commit, while the write lock is still held.
+func (db *Database) autoCheckpoint() error {
+	if db.checkpointLogSize == 0 || db.Log.WAL == nil || db.Log.WAL.Size() < db.checkpointLogSize {
+		return nil
+	}
+	_, err := db.Log.Checkpoint()
+	return err
+}
 
-	return db.FileHandler.WritePage(DataPage)
+// abort undoes the open transaction and reloads the state it may have changed.
+func (db *Database) abort() error {
+	if err := db.Log.Abort(); err != nil {
+		return err
+	}
+	return db.reload()
+}
+
+// reload rereads the index, free-space map and catalog state from their pages.
+func (db *Database) reload() error {
+	MetaPage, err := db.Store.ReadPage(db.Index.MetaPageID)
+	if err != nil {
+		return err
+	}
+	if err := db.Index.loadMeta(MetaPage); err != nil {
+		return err
+	}
+	if err := db.FreeSpace.load(); err != nil {
+		return err
+	}
+	return db.Catalog.load()
+}
+
+// placeRecord adds record to a data page that the free-space map says has room,
+// allocating a new data page if none does, and returns where it was stored.
+// Records too large to share a data page are spilled into overflow pages first.
+func (db *Database) placeRecord(record *Record) (uint, uint, error) {
+	var PageSize int = db.Store.PageSize()
+
+	var AddToPage func(*Page) (uint, error) = func(DataPage *Page) (uint, error) {
+		return DataPage.AddRecord(record, PageSize)
+	}
+	var Needed int = record.Size()
+	if Needed > db.maxInlineRecordSize() {
+		FirstPageID, err := db.writeOverflow(joinEscaped(record.Fields, FieldSeparator))
+		if err != nil {
+			return 0, 0, err
+		}
+		AddToPage = func(DataPage *Page) (uint, error) {
+			return DataPage.AddOverflowRecord(FirstPageID, PageSize)
+		}
+		Needed = MinTrackedFreeSpace
+	}
+
+	if PageID := db.FreeSpace.Find(Needed); PageID != 0 {
+		DataPage, err := db.Store.ReadPage(PageID)
+		if err != nil {
+			return 0, 0, err
+		}
+		EntryIndex, err := AddToPage(DataPage)
+		if err == nil {
+			return PageID, EntryIndex, db.writeDataPage(DataPage)
+		}
+		if !errors.Is(err, ErrPageFull) {
+			return 0, 0, err
+		}
+		// The size estimate was too small for this page; correct its entry and
+		// fall back to a fresh page.
+		if err := db.FreeSpace.Update(PageID, DataPage.FreeSpace(PageSize)-Needed); err != nil {
+			return 0, 0, err
+		}
+	}
+
+	DataPage, err := db.Store.AllocatePage()
+	if err != nil {
+		return 0, 0, err
+	}
+	DataPage.Header.PageType = "Data"
+	EntryIndex, err := AddToPage(DataPage)
+	if errors.Is(err, ErrPageFull) {
+		return 0, 0, fmt.Errorf("record of %d bytes does not fit in a %d byte page", record.Size(), PageSize)
+	}
+	if err != nil {
+		return 0, 0, err
+	}
+	return DataPage.Header.PageID, EntryIndex, db.writeDataPage(DataPage)
+}
+
+// writeDataPage writes a data page and records its remaining room in the free-space map.
+// A data page left without records is freed instead, so that its space is reused.
+func (db *Database) writeDataPage(DataPage *Page) error {
+	if DataPage.RecordCount() == 0 {
+		if err := db.FreeSpace.Remove(DataPage.Header.PageID); err != nil {
+			return err
+		}
+		return db.Store.FreePage(DataPage.Header.PageID)
+	}
+	if err := db.Store.WritePage(DataPage); err != nil {
+		return err
+	}
+	return db.FreeSpace.Update(DataPage.Header.PageID, DataPage.FreeSpace(db.Store.PageSize()))
 }
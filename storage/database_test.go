@@ -0,0 +1,96 @@
+package storage
+
+import (
+	"fmt"
+	"os"
+	"testing"
+)
+
+func TestDatabaseInsertGetUpdate(t *testing.T) {
+	db := openTest(t, testPath(t))
+	defer db.Close()
+	for i := 0; i < 40; i++ {
+		if err := db.Insert(fmt.Sprintf("user:%d", i), fmt.Sprintf("v%d", i)); err != nil {
+			t.Fatalf("Insert: %v", err)
+		}
+	}
+	for i := 0; i < 40; i++ {
+		Record, err := db.Get(fmt.Sprintf("user:%d", i))
+		if err != nil || Record == nil || Record.Fields[1] != fmt.Sprintf("v%d", i) {
+			t.Fatalf("Get user:%d = %v, %v", i, Record, err)
+		}
+	}
+	if Record, err := db.Get("missing"); Record != nil || err != nil {
+		t.Fatalf("Get of a missing ID = %v, %v", Record, err)
+	}
+	if err := db.Insert("user:3", "duplicate"); err == nil {
+		t.Fatal("Insert accepted a duplicate ID")
+	}
+	if err := db.Insert("", "empty"); err == nil {
+		t.Fatal("Insert accepted an empty ID")
+	}
+	if err := db.Update("user:7", "new"); err != nil {
+		t.Fatalf("Update: %v", err)
+	}
+	if Record, _ := db.Get("user:7"); Record == nil || Record.Fields[1] != "new" {
+		t.Fatalf("Get after Update = %v", Record)
+	}
+	if err := db.Update("missing", "x"); err == nil {
+		t.Fatal("Update of a missing ID succeeded")
+	}
+}
+
+func TestDatabaseReopen(t *testing.T) {
+	var Path string = testPath(t)
+	db := openTest(t, Path, WithBTreeOrder(4))
+	insertKeys(t, db, "k", 50, "v")
+	for i := 0; i < 20; i++ {
+		if err := db.Delete(fmt.Sprintf("k%03d", i*2)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := db.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	db = openTest(t, Path)
+	defer db.Close()
+	if db.Index.KeyCount != 30 || db.Index.Height < 2 || db.Index.Order != 4 {
+		t.Fatalf("reopened index has KeyCount %d, Height %d, Order %d", db.Index.KeyCount, db.Index.Height, db.Index.Order)
+	}
+	Records, err := db.Scan("", "")
+	if err != nil || len(Records) != 30 {
+		t.Fatalf("Scan returned %d records, %v", len(Records), err)
+	}
+	if Record, _ := db.Get("k049"); Record == nil {
+		t.Fatal("k049 is missing after reopening")
+	}
+}
+
+func TestDatabaseOpensLegacyFile(t *testing.T) {
+	Data, err := os.ReadFile("../main/mydatabase.db")
+	if err != nil {
+		t.Skipf("no legacy database file: %v", err)
+	}
+	var Path string = testPath(t)
+	if err := os.WriteFile(Path, Data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	db := openTest(t, Path)
+	Record, err := db.Get("user:2")
+	if err != nil || Record == nil || Record.Fields[1] != "Jane Doe" || db.Index.KeyCount != 1 {
+		t.Fatalf("Get user:2 = %v, %v", Record, err)
+	}
+	if err := db.Insert("user:3", "x"); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	db = openTest(t, Path)
+	defer db.Close()
+	if Record, _ := db.Get("user:3"); Record == nil || db.Index.KeyCount != 2 {
+		t.Fatalf("user:3 = %v with KeyCount %d after reopening", Record, db.Index.KeyCount)
+	}
+}
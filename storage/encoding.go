@@ -0,0 +1,134 @@
+package storage
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// The text format separates lines with newlines, keys from values with ": ", list
+// items with "," and record fields with "|". Every serializer in this package passes
+// user data through escapeValue or joinEscaped so that those characters, and any
+// bytes that are not printable UTF-8, never appear raw.
+//
+// Escapes are a backslash followed by one of:
+//
+//	\\  \n  \r  \t      backslash, newline, carriage return, tab
+//	\xHH                a single byte given in hex
+//	\<c>                the delimiter character c itself, one of | , :
+const (
+	FieldSeparator byte = '|'
+	ListSeparator  byte = ','
+)
+
+// escapeValue escapes s so that it contains no newlines, no bytes outside printable
+// UTF-8, and none of the delimiter characters in specials.
+func escapeValue(s string, specials string) string {
+	var Builder strings.Builder
+	for i := 0; i < len(s); {
+		Rune, Size := utf8.DecodeRuneInString(s[i:])
+		switch {
+		case Rune == '\\':
+			Builder.WriteString(`\\`)
+		case Rune == '\n':
+			Builder.WriteString(`\n`)
+		case Rune == '\r':
+			Builder.WriteString(`\r`)
+		case Rune == '\t':
+			Builder.WriteString(`\t`)
+		case Rune == utf8.RuneError && Size <= 1, Rune < 0x20, Rune == 0x7f:
+			fmt.Fprintf(&Builder, `\x%02x`, s[i])
+		case Size == 1 && strings.IndexByte(specials, s[i]) != -1:
+			Builder.WriteByte('\\')
+			Builder.WriteByte(s[i])
+		default:
+			Builder.WriteString(s[i : i+Size])
+		}
+		i += Size
+	}
+	return Builder.String()
+}
+
+// unescapeValue reverses escapeValue. A backslash that does not start one of the
+// escapes above is kept as written, so text from files that predate escaping, such
+// as Windows paths, reads back unchanged.
+func unescapeValue(s string) string {
+	if strings.IndexByte(s, '\\') == -1 {
+		return s
+	}
+
+	var Builder strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] != '\\' || i+1 == len(s) {
+			Builder.WriteByte(s[i])
+			continue
+		}
+		i++
+		switch s[i] {
+		case 'n':
+			Builder.WriteByte('\n')
+		case 'r':
+			Builder.WriteByte('\r')
+		case 't':
+			Builder.WriteByte('\t')
+		case 'x':
+			if i+2 < len(s) {
+				if Byte, err := strconv.ParseUint(s[i+1:i+3], 16, 8); err == nil {
+					Builder.WriteByte(byte(Byte))
+					i += 2
+					continue
+				}
+			}
+			Builder.WriteString(`\x`)
+		case '\\', FieldSeparator, ListSeparator, ':':
+			Builder.WriteByte(s[i])
+		default:
+			Builder.WriteByte('\\')
+			Builder.WriteByte(s[i])
+		}
+	}
+	return Builder.String()
+}
+
+// joinEscaped escapes each item and joins them with separator.
+func joinEscaped(items []string, separator byte) string {
+	var Escaped []string = make([]string, len(items))
+	for i, Item := range items {
+		Escaped[i] = escapeValue(Item, string(separator))
+	}
+	return strings.Join(Escaped, string(separator))
+}
+
+// splitEscaped splits s on every separator that is not escaped and unescapes the
+// items. Like strings.Split, an empty string yields a single empty item.
+func splitEscaped(s string, separator byte) []string {
+	var Items []string
+	var Start int = 0
+	for i := 0; i < len(s); i++ {
+		if s[i] == '\\' {
+			i++
+			continue
+		}
+		if s[i] == separator {
+			Items = append(Items, unescapeValue(s[Start:i]))
+			Start = i + 1
+		}
+	}
+	return append(Items, unescapeValue(s[Start:]))
+}
+
+// splitLine splits a "Key: Value" line of the text format at the first ": " that is
+// not part of an escape, and unescapes both halves.
+func splitLine(line string) (string, string, bool) {
+	for i := 0; i+1 < len(line); i++ {
+		if line[i] == '\\' {
+			i++
+			continue
+		}
+		if line[i] == ':' && line[i+1] == ' ' {
+			return unescapeValue(line[:i]), unescapeValue(line[i+2:]), true
+		}
+	}
+	return "", "", false
+}
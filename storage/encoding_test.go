@@ -0,0 +1,76 @@
+package storage
+
+import (
+	"os"
+	"testing"
+)
+
+func TestDatabaseEscapesIDsAndData(t *testing.T) {
+	var Path string = testPath(t)
+	var Values []string = []string{"a,b", "x|y", "line1\nline2", "k: v", "back\\slash", "\xff\x00bin", "tab\there", " spaced ", "# PAGE", "PageID: 1", "\\x4", "ünï"}
+	db := openTest(t, Path, WithFormat(TextFormat), WithBTreeOrder(4))
+	for i, ID := range Values {
+		if err := db.Insert(ID, Values[len(Values)-1-i]); err != nil {
+			t.Fatalf("Insert %q: %v", ID, err)
+		}
+	}
+	if err := db.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	db = openTest(t, Path)
+	defer db.Close()
+	for i, ID := range Values {
+		Record, err := db.Get(ID)
+		if err != nil || Record == nil || len(Record.Fields) != 2 || Record.Fields[0] != ID || Record.Fields[1] != Values[len(Values)-1-i] {
+			t.Fatalf("Get %q = %#v, %v", ID, Record, err)
+		}
+	}
+	if Records, _ := db.Scan("", ""); len(Records) != len(Values) {
+		t.Fatalf("Scan returned %d records, want %d", len(Records), len(Values))
+	}
+}
+
+func TestUnescapeKeepsUnknownEscapes(t *testing.T) {
+	var Cases map[string]string = map[string]string{
+		`C:\path\dir`: `C:\path\dir`,
+		`a\|b\,c\:d`:  "a|b,c:d",
+		`\\\n\r\t`:    "\\\n\r\t",
+		`\x41\xZZ\x4`: `A\xZZ\x4`,
+		`trailing\`:   `trailing\`,
+	}
+	for Escaped, Want := range Cases {
+		if Got := unescapeValue(Escaped); Got != Want {
+			t.Fatalf("unescapeValue(%q) = %q, want %q", Escaped, Got, Want)
+		}
+	}
+}
+
+func TestDatabaseReadsLegacyBackslashes(t *testing.T) {
+	var Path string = testPath(t)
+	var Legacy string = "# DATABASE HEADER\nPAGESIZE=4096\nENCODING=UTF-8\nVERSION=1.0\nPAGES=0\n\n\n" +
+		"# PAGE\nPageID: 1\nLSN: 0\nType: Index\nIsLeaf: true\nKeys: dir\\a\nPointers: 2:1\n" +
+		"# PAGE\nPageID: 2\nLSN: 0\nType: Data\nEntry-1: dir\\a|C:\\path\\dir\nEntryIndex: 1\n"
+	if err := os.WriteFile(Path, []byte(Legacy), 0644); err != nil {
+		t.Fatal(err)
+	}
+	db := openTest(t, Path)
+	Record, err := db.Get(`dir\a`)
+	if err != nil || Record == nil || Record.Fields[1] != `C:\path\dir` {
+		t.Fatalf("Get of a legacy record with backslashes = %v, %v", Record, err)
+	}
+	if err := db.Insert(`new\b`, `D:\other`); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	db = openTest(t, Path)
+	defer db.Close()
+	for ID, Data := range map[string]string{`dir\a`: `C:\path\dir`, `new\b`: `D:\other`} {
+		if Record, err := db.Get(ID); err != nil || Record == nil || Record.Fields[1] != Data {
+			t.Fatalf("Get %q after reopening = %v, %v", ID, Record, err)
+		}
+	}
+}
@@ -0,0 +1,153 @@
+package storage
+
+import (
+	"fmt"
+	"slices"
+	"strconv"
+)
+
+// MinTrackedFreeSpace is the least free space, in bytes, for which a data page is
+// kept in the free-space map. Pages with less room are unlikely to fit a record.
+const MinTrackedFreeSpace int = 64
+
+// FreeSpaceMap tracks which data pages still have room for records so that inserts
+// fill existing pages before allocating new ones. It lives in its own "FreeSpace"
+// page, which the metadata page points to.
+type FreeSpaceMap struct {
+	PageID    uint
+	FreeBytes map[uint]int
+	Store     PageStore
+}
+
+// OpenFreeSpaceMap loads the free-space map, creating its page and recording it in
+// the metadata page if the database does not have one yet.
+func OpenFreeSpaceMap(Store PageStore) (*FreeSpaceMap, error) {
+	var FreeSpace *FreeSpaceMap = &FreeSpaceMap{
+		FreeBytes: make(map[uint]int),
+		Store:     Store,
+	}
+
+	MetaPage, err := Store.ReadPage(MetaPageID)
+	if err != nil {
+		return nil, err
+	}
+	if PageIDString, KeyExists := MetaPage.Data["FreeSpacePageID"]; KeyExists {
+		PageID, err := strconv.ParseUint(PageIDString, 10, 32)
+		if err != nil {
+			return nil, fmt.Errorf("corrupt free space page pointer '%s'", PageIDString)
+		}
+		FreeSpace.PageID = uint(PageID)
+		return FreeSpace, FreeSpace.load()
+	}
+
+	FreeSpacePage, err := Store.AllocatePage()
+	if err != nil {
+		return nil, err
+	}
+	FreeSpacePage.Header.PageType = "FreeSpace"
+	FreeSpace.PageID = FreeSpacePage.Header.PageID
+	if err := FreeSpace.save(); err != nil {
+		return nil, err
+	}
+
+	MetaPage.Data["FreeSpacePageID"] = strconv.FormatUint(uint64(FreeSpace.PageID), 10)
+	if err := Store.WritePage(MetaPage); err != nil {
+		return nil, err
+	}
+	return FreeSpace, nil
+}
+
+// Find returns the data page with the least free space that still fits Needed bytes,
+// or 0 if no tracked page has enough room.
+func (self *FreeSpaceMap) Find(Needed int) uint {
+	var BestPageID uint = 0
+	var BestFree int = 0
+	for PageID, Free := range self.FreeBytes {
+		if Free < Needed {
+			continue
+		}
+		if BestPageID == 0 || Free < BestFree || (Free == BestFree && PageID < BestPageID) {
+			BestPageID, BestFree = PageID, Free
+		}
+	}
+	return BestPageID
+}
+
+// Update records how much room a data page has left and persists the map.
+func (self *FreeSpaceMap) Update(PageID uint, FreeBytes int) error {
+	var OldFree, Tracked = self.FreeBytes[PageID]
+	if FreeBytes < MinTrackedFreeSpace {
+		if !Tracked {
+			return nil
+		}
+		delete(self.FreeBytes, PageID)
+	} else {
+		if Tracked && OldFree == FreeBytes {
+			return nil
+		}
+		self.FreeBytes[PageID] = FreeBytes
+	}
+	return self.save()
+}
+
+// Remove stops tracking a data page and persists the map.
+func (self *FreeSpaceMap) Remove(PageID uint) error {
+	if _, Tracked := self.FreeBytes[PageID]; !Tracked {
+		return nil
+	}
+	delete(self.FreeBytes, PageID)
+	return self.save()
+}
+
+// load parses the map from its page. Each entry is written as "PageID:FreeBytes".
+func (self *FreeSpaceMap) load() error {
+	Page, err := self.Store.ReadPage(self.PageID)
+	if err != nil {
+		return err
+	}
+	if Page.Header.PageType != "FreeSpace" {
+		return fmt.Errorf("page %d is a %s page, expected the free space map", self.PageID, Page.Header.PageType)
+	}
+	clear(self.FreeBytes)
+	if Pages := Page.Data["Pages"]; Pages != "" {
+		for _, Entry := range splitEscaped(Pages, ListSeparator) {
+			var PageID uint
+			var Free int
+			if _, err := fmt.Sscanf(Entry, "%d:%d", &PageID, &Free); err != nil {
+				return fmt.Errorf("corrupt free space entry '%s'", Entry)
+			}
+			self.FreeBytes[PageID] = Free
+		}
+	}
+	return nil
+}
+
+// save writes the map to its page. If the map has outgrown the page, the entries
+// with the least free space are dropped; those pages simply stop receiving inserts.
+func (self *FreeSpaceMap) save() error {
+	var PageIDs []uint = make([]uint, 0, len(self.FreeBytes))
+	for PageID := range self.FreeBytes {
+		PageIDs = append(PageIDs, PageID)
+	}
+	slices.SortFunc(PageIDs, func(a, b uint) int {
+		return self.FreeBytes[b] - self.FreeBytes[a]
+	})
+
+	var Page *Page = &Page{
+		Header: PageHeader{PageID: self.PageID, PageType: "FreeSpace"},
+		Data:   make(map[string]string),
+	}
+	for {
+		var Entries []string = make([]string, len(PageIDs))
+		for i, PageID := range PageIDs {
+			Entries[i] = fmt.Sprintf("%d:%d", PageID, self.FreeBytes[PageID])
+		}
+		Page.Data["Pages"] = joinEscaped(Entries, ListSeparator)
+		if Page.Size() <= self.Store.PageSize() || len(PageIDs) == 0 {
+			break
+		}
+		delete(self.FreeBytes, PageIDs[len(PageIDs)-1])
+		PageIDs = PageIDs[:len(PageIDs)-1]
+	}
+	return self.Store.WritePage(Page)
+}
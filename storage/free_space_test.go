@@ -0,0 +1,42 @@
+package storage
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestDatabasePacksAndMovesRecords(t *testing.T) {
+	var Path string = testPath(t)
+	db := openTest(t, Path)
+	for i := 0; i < 300; i++ {
+		if err := db.Insert(fmt.Sprintf("user:%d", i), fmt.Sprintf("name %d", i)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// 300 short records share a handful of data pages.
+	if PageCount := db.Store.PageCount(); PageCount > 20 {
+		t.Fatalf("300 short records use %d pages", PageCount)
+	}
+	var Big string = strings.Repeat("b", 1500)
+	for i := 0; i < 10; i++ {
+		if err := db.Update(fmt.Sprintf("user:%d", i), Big); err != nil {
+			t.Fatalf("Update: %v", err)
+		}
+	}
+	if err := db.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	db = openTest(t, Path)
+	defer db.Close()
+	for i := 0; i < 300; i++ {
+		Record, err := db.Get(fmt.Sprintf("user:%d", i))
+		if err != nil || Record == nil {
+			t.Fatalf("Get user:%d = %v, %v", i, Record, err)
+		}
+		if i < 10 && Record.Fields[1] != Big {
+			t.Fatalf("user:%d lost its grown data", i)
+		}
+	}
+}
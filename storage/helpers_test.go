@@ -0,0 +1,107 @@
+package storage
+
+import (
+	"fmt"
+	"path/filepath"
+	"testing"
+)
+
+// fileFormats are the storage formats that keep a file and a write-ahead log.
+var fileFormats = []StorageFormat{BinaryFormat, TextFormat}
+
+// testPath returns the path of a database file in a fresh temporary directory.
+func testPath(t *testing.T) string {
+	return filepath.Join(t.TempDir(), "test.db")
+}
+
+// openTest opens a database and fails the test if it cannot.
+func openTest(t *testing.T, Path string, Opts ...Option) *Database {
+	t.Helper()
+	db, err := OpenDatabase(Path, Opts...)
+	if err != nil {
+		t.Fatalf("OpenDatabase(%s): %v", Path, err)
+	}
+	return db
+}
+
+// insertKeys inserts the records "<prefix>000".."<prefix>N-1" with Value.
+func insertKeys(t *testing.T, db *Database, Prefix string, N int, Value string) {
+	t.Helper()
+	for i := 0; i < N; i++ {
+		if err := db.Insert(fmt.Sprintf("%s%03d", Prefix, i), Value); err != nil {
+			t.Fatalf("Insert %s%03d: %v", Prefix, i, err)
+		}
+	}
+}
+
+// backingStore returns the file handler or memory store beneath the log and the
+// buffer pool.
+func backingStore(Store PageStore) PageStore {
+	for {
+		switch Wrapper := Store.(type) {
+		case *LoggedStore:
+			Store = Wrapper.Store
+		case *BufferPool:
+			Store = Wrapper.Store
+		default:
+			return Store
+		}
+	}
+}
+
+// crash closes the files of db without flushing the buffer pool, syncing or
+// checkpointing, as if the process had died.
+func crash(db *Database) {
+	switch Handler := backingStore(db.Store).(type) {
+	case *BinaryFileHandler:
+		Handler.File.Close()
+	case *TextFileHandler:
+		Handler.File.Close()
+	}
+	db.Log.WAL.File.Close()
+}
+
+// checkTree checks the subtree rooted at PageID for ordered keys within
+// [Low, High), node fill and child counts, and returns how many keys its leaves hold.
+func checkTree(t *testing.T, Tree *BPlusTree, PageID uint, IsRoot bool, Low string, High string) int {
+	t.Helper()
+	Node, err := Tree.readNode(PageID)
+	if err != nil {
+		t.Fatalf("read node %d: %v", PageID, err)
+	}
+	if !IsRoot && Tree.Order > 0 && Tree.isUnderfull(Node) {
+		t.Fatalf("node %d is underfull: %v", PageID, Node.Keys)
+	}
+	if Tree.isOverfull(Node) {
+		t.Fatalf("node %d is overfull", PageID)
+	}
+	for i, Key := range Node.Keys {
+		if (Low != "" && Key < Low) || (High != "" && Key >= High) || (i > 0 && Node.Keys[i-1] >= Key) {
+			t.Fatalf("node %d keys %q are out of order or outside [%q, %q)", PageID, Node.Keys, Low, High)
+		}
+	}
+	if Node.IsLeaf {
+		return len(Node.Keys)
+	}
+	if len(Node.Children) != len(Node.Keys)+1 {
+		t.Fatalf("internal node %d has %d keys and %d children", PageID, len(Node.Keys), len(Node.Children))
+	}
+	var Total int = 0
+	for i, Child := range Node.Children {
+		var ChildLow, ChildHigh string = Low, High
+		if i > 0 {
+			ChildLow = Node.Keys[i-1]
+		}
+		if i < len(Node.Keys) {
+			ChildHigh = Node.Keys[i]
+		}
+		Total += checkTree(t, Tree, Child, false, ChildLow, ChildHigh)
+	}
+	return Total
+}
+
+// countKeys checks the whole tree and returns how many keys it holds.
+func countKeys(t *testing.T, Tree *BPlusTree) int {
+	t.Helper()
+	return checkTree(t, Tree, Tree.RootPageID, true, "", "")
+}
@@ -0,0 +1,114 @@
+package storage
+
+import (
+	"slices"
+	"sync"
+)
+
+// latchTable hands out one read/write latch per page. Latches only exist while
+// some goroutine holds or waits for them.
+type latchTable struct {
+	Mutex   sync.Mutex
+	latches map[uint]*pageLatch
+}
+
+// pageLatch is the latch of one page.
+type pageLatch struct {
+	Mutex sync.RWMutex
+	users int // Goroutines holding or waiting for the latch
+}
+
+// lock latches a page, shared or exclusive, waiting for conflicting holders.
+func (self *latchTable) lock(PageID uint, Exclusive bool) {
+	self.Mutex.Lock()
+	if self.latches == nil {
+		self.latches = make(map[uint]*pageLatch)
+	}
+	Latch, Exists := self.latches[PageID]
+	if !Exists {
+		Latch = &pageLatch{}
+		self.latches[PageID] = Latch
+	}
+	Latch.users++
+	self.Mutex.Unlock()
+
+	if Exclusive {
+		Latch.Mutex.Lock()
+	} else {
+		Latch.Mutex.RLock()
+	}
+}
+
+// unlock releases a latch taken by lock with the same mode.
+func (self *latchTable) unlock(PageID uint, Exclusive bool) {
+	self.Mutex.Lock()
+	defer self.Mutex.Unlock()
+
+	var Latch *pageLatch = self.latches[PageID]
+	if Exclusive {
+		Latch.Mutex.Unlock()
+	} else {
+		Latch.Mutex.RUnlock()
+	}
+	if Latch.users--; Latch.users == 0 {
+		delete(self.latches, PageID)
+	}
+}
+
+// latchPath is the set of exclusive latches a writer holds on its way down the
+// tree: the root latch while the root may still change, and the pages from the
+// deepest node that cannot absorb a split or merge on its own downwards.
+type latchPath struct {
+	Tree  *BPlusTree
+	root  bool
+	pages []uint
+}
+
+// lockRoot takes the tree's root latch exclusively.
+func (self *latchPath) lockRoot() {
+	self.Tree.rootLatch.Lock()
+	self.root = true
+}
+
+// lock latches a page exclusively and adds it to the path.
+func (self *latchPath) lock(PageID uint) {
+	self.Tree.latches.lock(PageID, true)
+	self.pages = append(self.pages, PageID)
+}
+
+// atRoot reports whether the last page locked is the root, which is only known
+// while the root latch is still held.
+func (self *latchPath) atRoot() bool {
+	return self.root && len(self.pages) == 1
+}
+
+// holds reports whether the path still latches a page. A page it no longer holds
+// was released because a node below it absorbs the change.
+func (self *latchPath) holds(PageID uint) bool {
+	return slices.Contains(self.pages, PageID)
+}
+
+// releaseAncestors releases every latch except the one on the last page locked,
+// once that page is known to absorb the change without touching its parent.
+func (self *latchPath) releaseAncestors() {
+	if self.root {
+		self.Tree.rootLatch.Unlock()
+		self.root = false
+	}
+	for _, PageID := range self.pages[:len(self.pages)-1] {
+		self.Tree.latches.unlock(PageID, true)
+	}
+	self.pages = self.pages[len(self.pages)-1:]
+}
+
+// releaseAll releases every latch on the path.
+func (self *latchPath) releaseAll() {
+	if self.root {
+		self.Tree.rootLatch.Unlock()
+		self.root = false
+	}
+	for _, PageID := range self.pages {
+		self.Tree.latches.unlock(PageID, true)
+	}
+	self.pages = nil
+}
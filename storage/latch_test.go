@@ -0,0 +1,164 @@
+package storage
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestBPlusTreeConcurrentWritersAndCursors(t *testing.T) {
+	for _, Order := range []int{0, 4} {
+		Tree, err := NewBPlusTree(NewMemoryPageStore(DefaultPageSize), Order)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var Workers sync.WaitGroup
+		for g := 0; g < 8; g++ {
+			Workers.Add(1)
+			go func(g int) {
+				defer Workers.Done()
+				for i := 0; i < 300; i++ {
+					var Key string = fmt.Sprintf("g%d-%04d", g, i)
+					if err := Tree.Insert(Key, uint(g), uint(i)); err != nil {
+						t.Errorf("Insert %s: %v", Key, err)
+						return
+					}
+					if _, _, err := Tree.Find(Key); err != nil {
+						t.Errorf("Find %s: %v", Key, err)
+						return
+					}
+				}
+				for i := 0; i < 300; i += 2 {
+					if err := Tree.Delete(fmt.Sprintf("g%d-%04d", g, i)); err != nil {
+						t.Errorf("Delete: %v", err)
+						return
+					}
+				}
+			}(g)
+		}
+		for r := 0; r < 2; r++ {
+			Workers.Add(1)
+			go func() {
+				defer Workers.Done()
+				for n := 0; n < 50; n++ {
+					var Cursor *Cursor = Tree.Cursor()
+					var Last string
+					for Valid := Cursor.First(); Valid; Valid = Cursor.Next() {
+						if Cursor.Key() <= Last {
+							t.Errorf("cursor went from %q back to %q", Last, Cursor.Key())
+							return
+						}
+						Last = Cursor.Key()
+					}
+					if err := Cursor.Err(); err != nil {
+						t.Error(err)
+						return
+					}
+				}
+			}()
+		}
+		Workers.Wait()
+		if Count := countKeys(t, Tree); Count != 8*150 || Tree.KeyCount != 8*150 {
+			t.Fatalf("order %d: tree holds %d keys with KeyCount %d, want %d", Order, Count, Tree.KeyCount, 8*150)
+		}
+	}
+}
+
+func TestBPlusTreeConcurrentDeletesOfVariableLengthKeys(t *testing.T) {
+	for Round := 0; Round < 5; Round++ {
+		Tree, err := NewBPlusTree(NewMemoryPageStore(1024), 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		// Keys of very different lengths, so that one delete can leave a node
+		// underfull while another leaves it well filled.
+		var KeyOf = func(g int, i int) string {
+			return fmt.Sprintf("g%d-%04d-%s", g, i, strings.Repeat("x", (i*37+g*11)%100))
+		}
+		for g := 0; g < 8; g++ {
+			for i := 0; i < 200; i++ {
+				if err := Tree.Insert(KeyOf(g, i), uint(g), uint(i)); err != nil {
+					t.Fatal(err)
+				}
+			}
+		}
+		var Workers sync.WaitGroup
+		for g := 0; g < 8; g++ {
+			Workers.Add(1)
+			go func(g int) {
+				defer Workers.Done()
+				for i := 0; i < 200; i++ {
+					if i%4 == 3 {
+						continue
+					}
+					if err := Tree.Delete(KeyOf(g, i)); err != nil {
+						t.Errorf("Delete %s: %v", KeyOf(g, i), err)
+						return
+					}
+				}
+			}(g)
+		}
+		Workers.Wait()
+		if t.Failed() {
+			return
+		}
+		if Count := countKeys(t, Tree); Count != 8*50 || Tree.KeyCount != 8*50 {
+			t.Fatalf("tree holds %d keys with KeyCount %d, want %d", Count, Tree.KeyCount, 8*50)
+		}
+		for g := 0; g < 8; g++ {
+			for i := 3; i < 200; i += 4 {
+				if _, _, err := Tree.Find(KeyOf(g, i)); err != nil {
+					t.Fatalf("Find %s: %v", KeyOf(g, i), err)
+				}
+			}
+		}
+	}
+}
+
+func TestDatabaseInsertBatch(t *testing.T) {
+	for _, Format := range fileFormats {
+		var Path string = testPath(t)
+		db := openTest(t, Path, WithFormat(Format), WithBufferPool(64))
+		var Records map[string]string = make(map[string]string)
+		for i := 0; i < 1000; i++ {
+			Records[fmt.Sprintf("k%04d-%s", i, strings.Repeat("x", i%50))] = fmt.Sprint(i)
+		}
+		if err := db.InsertBatch(Records); err != nil {
+			t.Fatalf("%v: InsertBatch: %v", Format, err)
+		}
+
+		// One existing ID rejects the whole batch.
+		var Existing string = fmt.Sprintf("k%04d-%s", 7, strings.Repeat("x", 7))
+		if err := db.InsertBatch(map[string]string{"new": "v", Existing: "v"}); err == nil {
+			t.Fatalf("%v: InsertBatch accepted an existing ID", Format)
+		}
+		tx, err := db.Begin()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := tx.InsertBatch(map[string]string{"in-tx": "v"}); err != nil {
+			t.Fatal(err)
+		}
+		if err := tx.Commit(); err != nil {
+			t.Fatal(err)
+		}
+		if err := db.Close(); err != nil {
+			t.Fatal(err)
+		}
+
+		db = openTest(t, Path)
+		for ID, Data := range Records {
+			if Record, err := db.Get(ID); err != nil || Record == nil || Record.Fields[1] != Data {
+				t.Fatalf("%v: Get %s = %v, %v", Format, ID, Record, err)
+			}
+		}
+		if Record, _ := db.Get("new"); Record != nil {
+			t.Fatalf("%v: record of a rejected batch survived", Format)
+		}
+		if Count := countKeys(t, db.Index); Count != 1001 {
+			t.Fatalf("%v: index holds %d keys, want 1001", Format, Count)
+		}
+		db.Close()
+	}
+}
@@ -0,0 +1,375 @@
+package storage
+
+import (
+	"fmt"
+	"slices"
+	"sync"
+)
+
+// LoggedStore is a PageStore that writes a LogRecord to a WriteAheadLog before
+// every page write and stamps the page's PageLSN with the record's LSN. Writes are
+// grouped into transactions with Begin, Commit and Abort; writes made outside a
+// transaction are logged with TxID 0 and are never undone.
+//
+// The committed image of every page a transaction changes is kept in Versions
+// until no snapshot needs it, so that readers never see uncommitted changes.
+//
+// Without a WAL, as for in-memory databases, the updates of the open transaction
+// are still kept so that it can be aborted, but nothing is logged durably.
+//
+// Pages freed during a transaction are only released when it commits, so that an
+// abort never has to bring back a page that something else has reused.
+type LoggedStore struct {
+	Store     PageStore
+	WAL       *WriteAheadLog // Nil for in-memory and WithPageStore databases
+	Versions  *VersionStore
+	Mutex     sync.Mutex
+	txID      uint64
+	lastLSN   uint64        // Last LSN handed out when there is no WAL
+	undo      []*LogRecord  // Updates of the open transaction, oldest first
+	allocated map[uint]bool // Pages allocated but not yet written
+	freed     []uint        // Pages to free when the open transaction commits
+}
+
+// Savepoint marks a point in the open transaction that RollbackTo can return to.
+type Savepoint struct {
+	updates int
+	freed   int
+}
+
+// NewLoggedStore logs the writes made to Store in WAL, which may be nil.
+func NewLoggedStore(Store PageStore, WAL *WriteAheadLog) *LoggedStore {
+	return &LoggedStore{
+		Store:     Store,
+		WAL:       WAL,
+		Versions:  NewVersionStore(),
+		allocated: make(map[uint]bool),
+	}
+}
+
+// Begin starts a transaction. Only one transaction can be open at a time.
+func (self *LoggedStore) Begin() error {
+	self.Mutex.Lock()
+	defer self.Mutex.Unlock()
+
+	if self.txID != 0 {
+		return fmt.Errorf("transaction %d is already open", self.txID)
+	}
+	var Begin *LogRecord = &LogRecord{Type: LogBegin}
+	if _, err := self.append(Begin); err != nil {
+		return err
+	}
+	self.txID = Begin.TxID
+	return nil
+}
+
+// Commit logs the end of the open transaction and syncs the log, so that its
+// changes survive a crash once Commit returns. Pages it freed are released after.
+func (self *LoggedStore) Commit() error {
+	self.Mutex.Lock()
+	defer self.Mutex.Unlock()
+
+	if self.txID == 0 {
+		return fmt.Errorf("no transaction is open")
+	}
+	LSN, err := self.append(&LogRecord{TxID: self.txID, Type: LogCommit})
+	if err != nil {
+		return err
+	}
+	if err := self.flush(LSN); err != nil {
+		return err
+	}
+	// Pages are freed under the version lock, so that snapshot readers never see
+	// a page the commit freed before it is on the deallocated list.
+	self.Versions.Mutex.Lock()
+	defer self.Versions.Mutex.Unlock()
+	if err := self.Versions.commit(LSN, self.Store, self.freed); err != nil {
+		return err
+	}
+
+	var Freed []uint = self.freed
+	self.endTransaction()
+	for _, PageID := range Freed {
+		if err := self.Store.FreePage(PageID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Abort undoes every write of the open transaction and logs its end.
+func (self *LoggedStore) Abort() error {
+	self.Mutex.Lock()
+	defer self.Mutex.Unlock()
+
+	if self.txID == 0 {
+		return fmt.Errorf("no transaction is open")
+	}
+	if err := self.rollbackTo(Savepoint{}); err != nil {
+		return err
+	}
+	self.Versions.Mutex.Lock()
+	self.Versions.abort()
+	self.Versions.Mutex.Unlock()
+	if _, err := self.append(&LogRecord{TxID: self.txID, Type: LogAbort}); err != nil {
+		return err
+	}
+	self.endTransaction()
+	return nil
+}
+
+// Savepoint returns the current position in the open transaction.
+func (self *LoggedStore) Savepoint() Savepoint {
+	self.Mutex.Lock()
+	defer self.Mutex.Unlock()
+	return Savepoint{updates: len(self.undo), freed: len(self.freed)}
+}
+
+// RollbackTo undoes the writes made since Savepoint was taken and leaves the
+// transaction open.
+func (self *LoggedStore) RollbackTo(Savepoint Savepoint) error {
+	self.Mutex.Lock()
+	defer self.Mutex.Unlock()
+
+	if self.txID == 0 {
+		return fmt.Errorf("no transaction is open")
+	}
+	return self.rollbackTo(Savepoint)
+}
+
+// Checkpoint writes every change logged so far to the store and syncs it, records
+// the LSN of the last log record in the store's header, and empties the log, so
+// that recovery has nothing older to replay. It returns the checkpoint LSN. There
+// must be no open transaction.
+func (self *LoggedStore) Checkpoint() (uint64, error) {
+	self.Mutex.Lock()
+	defer self.Mutex.Unlock()
+
+	if self.txID != 0 {
+		return 0, fmt.Errorf("cannot checkpoint while transaction %d is open", self.txID)
+	}
+	if self.WAL == nil {
+		return 0, nil
+	}
+	if err := self.WAL.FlushAll(); err != nil {
+		return 0, err
+	}
+	if err := self.Store.Sync(); err != nil {
+		return 0, err
+	}
+
+	var LSN uint64 = self.WAL.NextLSN() - 1
+	if Checkpointer, Supported := checkpointerOf(self.Store); Supported {
+		if err := Checkpointer.SetCheckpointLSN(LSN); err != nil {
+			return 0, err
+		}
+	}
+	return LSN, self.WAL.Truncate()
+}
+
+// ReadPage returns a copy of the page with the given ID.
+func (self *LoggedStore) ReadPage(PageID uint) (*Page, error) {
+	return self.Store.ReadPage(PageID)
+}
+
+// WritePage logs the new page image and then writes the page, with its PageLSN
+// set to the LSN of the log record. The first write of a page in a transaction
+// preserves its committed image for snapshot readers.
+func (self *LoggedStore) WritePage(Page *Page) error {
+	if Size := Page.Size(); Size > self.Store.PageSize() {
+		return fmt.Errorf("%w: page %d is %d bytes, limit is %d", ErrPageOverflow, Page.Header.PageID, Size, self.Store.PageSize())
+	}
+
+	self.Mutex.Lock()
+	defer self.Mutex.Unlock()
+
+	Before, err := self.beforeImage(Page.Header.PageID)
+	if err != nil {
+		return err
+	}
+
+	// Snapshot readers either find the preserved version or the page as it was,
+	// never a page halfway through being replaced.
+	self.Versions.Mutex.Lock()
+	defer self.Versions.Mutex.Unlock()
+	if self.txID != 0 && Before != nil {
+		self.Versions.preserve(Page.Header.PageID, Before)
+	}
+	if err := self.write(Page, Before); err != nil {
+		return err
+	}
+	if self.txID == 0 {
+		self.Versions.committedLSN = Page.Header.PageLSN
+	}
+	return nil
+}
+
+// AllocatePage reserves a page ID. The first write of a new page is logged without
+// a before image, so that undoing it frees the page. To snapshots older than the
+// transaction's commit, the page is missing, even if it is a freed page being reused.
+func (self *LoggedStore) AllocatePage() (*Page, error) {
+	self.Mutex.Lock()
+	defer self.Mutex.Unlock()
+	self.Versions.Mutex.Lock()
+	defer self.Versions.Mutex.Unlock()
+
+	Page, err := self.Store.AllocatePage()
+	if err != nil {
+		return nil, err
+	}
+	self.allocated[Page.Header.PageID] = true
+	if self.txID != 0 {
+		self.Versions.preserve(Page.Header.PageID, nil)
+	}
+	return Page, nil
+}
+
+// FreePage frees a page, waiting for the open transaction to commit if there is one.
+func (self *LoggedStore) FreePage(PageID uint) error {
+	self.Mutex.Lock()
+	if self.txID != 0 {
+		defer self.Mutex.Unlock()
+		if slices.Contains(self.freed, PageID) {
+			return fmt.Errorf("Page %d is already deallocated", PageID)
+		}
+		self.freed = append(self.freed, PageID)
+		return nil
+	}
+	self.Mutex.Unlock()
+	return self.Store.FreePage(PageID)
+}
+
+// PageSize returns the size of a page in bytes.
+func (self *LoggedStore) PageSize() int {
+	return self.Store.PageSize()
+}
+
+// PageCount returns the highest PageID allocated so far.
+func (self *LoggedStore) PageCount() uint {
+	return self.Store.PageCount()
+}
+
+// Sync syncs the log and then the store.
+func (self *LoggedStore) Sync() error {
+	if self.WAL != nil {
+		if err := self.WAL.FlushAll(); err != nil {
+			return err
+		}
+	}
+	return self.Store.Sync()
+}
+
+// Close syncs the log, closes the store and then closes the log.
+func (self *LoggedStore) Close() error {
+	if self.WAL == nil {
+		return self.Store.Close()
+	}
+	if err := self.WAL.FlushAll(); err != nil {
+		self.Store.Close()
+		self.WAL.Close()
+		return err
+	}
+	if err := self.Store.Close(); err != nil {
+		self.WAL.Close()
+		return err
+	}
+	return self.WAL.Close()
+}
+
+// write logs an update from Before to Page under the open transaction and writes
+// the page. A store without a buffer pool gets the page immediately, so the log is
+// synced first; a BufferPool syncs it itself before writing the page back.
+func (self *LoggedStore) write(Page *Page, Before *Page) error {
+	var Update *LogRecord = &LogRecord{
+		TxID:   self.txID,
+		Type:   LogUpdate,
+		PageID: Page.Header.PageID,
+		Before: Before,
+		After:  Page.clone(),
+	}
+
+	LSN, err := self.append(Update)
+	if err != nil {
+		return err
+	}
+	Page.Header.PageLSN = LSN
+	if self.txID != 0 {
+		self.undo = append(self.undo, Update)
+	}
+
+	if _, Buffered := self.Store.(*BufferPool); !Buffered || self.txID == 0 {
+		if err := self.flush(LSN); err != nil {
+			return err
+		}
+	}
+	return self.Store.WritePage(Page)
+}
+
+// rollbackTo undoes the updates made since Savepoint, newest first. Restoring a
+// page is itself a logged write, and pages allocated since the savepoint are freed
+// again. Frees requested since the savepoint are forgotten.
+func (self *LoggedStore) rollbackTo(Savepoint Savepoint) error {
+	var Undo []*LogRecord = self.undo[Savepoint.updates:]
+	for i := len(Undo) - 1; i >= 0; i-- {
+		var Update *LogRecord = Undo[i]
+		if Update.Before == nil {
+			if err := self.Store.FreePage(Update.PageID); err != nil {
+				return err
+			}
+			continue
+		}
+		if err := self.write(Update.Before.clone(), Update.After); err != nil {
+			return err
+		}
+	}
+	for PageID := range self.allocated {
+		if err := self.Store.FreePage(PageID); err != nil {
+			return err
+		}
+	}
+	clear(self.allocated)
+	self.undo = self.undo[:Savepoint.updates]
+	self.freed = self.freed[:Savepoint.freed]
+	return nil
+}
+
+// append adds a record to the log, or just numbers it if there is no log.
+func (self *LoggedStore) append(Record *LogRecord) (uint64, error) {
+	if self.WAL != nil {
+		return self.WAL.Append(Record)
+	}
+	self.lastLSN++
+	Record.LSN = self.lastLSN
+	if Record.Type == LogBegin {
+		Record.TxID = Record.LSN
+	}
+	if Record.After != nil {
+		Record.After.Header.PageLSN = Record.LSN
+	}
+	return Record.LSN, nil
+}
+
+// flush makes the log durable up to LSN, if there is a log.
+func (self *LoggedStore) flush(LSN uint64) error {
+	if self.WAL == nil {
+		return nil
+	}
+	return self.WAL.Flush(LSN)
+}
+
+// beforeImage returns the current contents of a page that is about to be written,
+// or nil if it has been allocated and not written yet.
+func (self *LoggedStore) beforeImage(PageID uint) (*Page, error) {
+	if self.allocated[PageID] {
+		delete(self.allocated, PageID)
+		return nil, nil
+	}
+	return self.Store.ReadPage(PageID)
+}
+
+// endTransaction forgets the state of the open transaction.
+func (self *LoggedStore) endTransaction() {
+	self.txID = 0
+	self.undo = nil
+	self.freed = nil
+}
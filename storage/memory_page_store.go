@@ -0,0 +1,138 @@
+package storage
+
+import (
+	"fmt"
+	"slices"
+	"sync"
+)
+
+// MemoryFilePath is the file path OpenDatabase treats as a request for an in-memory
+// database.
+const MemoryFilePath string = ":memory:"
+
+// MemoryPageStore keeps pages in a map instead of a file. It has the same page
+// semantics as the file-backed stores, including PageSize enforcement, and its
+// contents are lost when it is closed.
+type MemoryPageStore struct {
+	Mutex            sync.RWMutex
+	Pages            map[uint]*Page
+	DeallocatedPages []uint
+	pageSize         int
+	pageCount        uint
+}
+
+// NewMemoryPageStore creates an empty in-memory store with the given page size.
+func NewMemoryPageStore(PageSize int) *MemoryPageStore {
+	return &MemoryPageStore{
+		Pages:            make(map[uint]*Page),
+		DeallocatedPages: []uint{},
+		pageSize:         PageSize,
+	}
+}
+
+// OpenInMemory opens an empty database that never touches the filesystem.
+func OpenInMemory(Opts ...Option) (*Database, error) {
+	return OpenDatabase(MemoryFilePath, Opts...)
+}
+
+// ReadPage returns a copy of a page, so callers can modify it freely until they
+// write it back.
+func (self *MemoryPageStore) ReadPage(PageID uint) (*Page, error) {
+	self.Mutex.RLock()
+	defer self.Mutex.RUnlock()
+
+	if PageID == 0 || PageID > self.pageCount {
+		return nil, fmt.Errorf("Invalid PageID: %d, PageCount: %d", PageID, self.pageCount)
+	}
+	Stored, Exists := self.Pages[PageID]
+	if !Exists {
+		return nil, fmt.Errorf("%w: PageID %d", ErrPageNotFound, PageID)
+	}
+	return Stored.clone(), nil
+}
+
+// WritePage stores a copy of the page.
+// It returns ErrPageOverflow if the page is larger than PageSize.
+func (self *MemoryPageStore) WritePage(Page *Page) error {
+	self.Mutex.Lock()
+	defer self.Mutex.Unlock()
+
+	if Page.Header.PageID == 0 {
+		return fmt.Errorf("Invalid PageID: 0")
+	}
+	if Size := Page.Size(); Size > self.pageSize {
+		return fmt.Errorf("%w: page %d is %d bytes, limit is %d", ErrPageOverflow, Page.Header.PageID, Size, self.pageSize)
+	}
+	self.Pages[Page.Header.PageID] = Page.clone()
+	self.pageCount = max(self.pageCount, Page.Header.PageID)
+	return nil
+}
+
+// AllocatePage finds an available page ID to use for new data.
+func (self *MemoryPageStore) AllocatePage() (*Page, error) {
+	self.Mutex.Lock()
+	defer self.Mutex.Unlock()
+
+	var PageID uint
+	if len(self.DeallocatedPages) > 0 {
+		PageID = self.DeallocatedPages[0]
+		self.DeallocatedPages = self.DeallocatedPages[1:]
+	} else {
+		self.pageCount++
+		PageID = self.pageCount
+	}
+
+	return &Page{
+		Header: PageHeader{PageID: PageID},
+		Data:   make(map[string]string),
+	}, nil
+}
+
+// FreePage returns a page to the deallocated list so that AllocatePage can reuse it.
+func (self *MemoryPageStore) FreePage(PageID uint) error {
+	self.Mutex.Lock()
+	defer self.Mutex.Unlock()
+
+	if PageID == 0 || PageID > self.pageCount {
+		return fmt.Errorf("Invalid PageID: %d, PageCount: %d", PageID, self.pageCount)
+	}
+	if slices.Contains(self.DeallocatedPages, PageID) {
+		return fmt.Errorf("Page %d is already deallocated", PageID)
+	}
+	self.DeallocatedPages = append(self.DeallocatedPages, PageID)
+	return nil
+}
+
+// PageSize returns the size of a page in bytes.
+func (self *MemoryPageStore) PageSize() int {
+	return self.pageSize
+}
+
+// PageCount returns the highest PageID allocated so far.
+func (self *MemoryPageStore) PageCount() uint {
+	self.Mutex.RLock()
+	defer self.Mutex.RUnlock()
+	return self.pageCount
+}
+
+// IsDeallocated reports whether a page is on the deallocated list.
+func (self *MemoryPageStore) IsDeallocated(PageID uint) bool {
+	self.Mutex.RLock()
+	defer self.Mutex.RUnlock()
+	return slices.Contains(self.DeallocatedPages, PageID)
+}
+
+// Sync does nothing; memory is as durable as this store gets.
+func (self *MemoryPageStore) Sync() error {
+	return nil
+}
+
+// Close drops every page.
+func (self *MemoryPageStore) Close() error {
+	self.Mutex.Lock()
+	defer self.Mutex.Unlock()
+	self.Pages = make(map[uint]*Page)
+	self.DeallocatedPages = []uint{}
+	self.pageCount = 0
+	return nil
+}
@@ -0,0 +1,62 @@
+package storage
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestOpenInMemory(t *testing.T) {
+	db, err := OpenInMemory(WithBTreeOrder(4))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	if _, IsMemory := backingStore(db.Store).(*MemoryPageStore); !IsMemory {
+		t.Fatalf("in-memory database uses %T", backingStore(db.Store))
+	}
+	var Document string = strings.Repeat("lorem|ipsum\n\\", 1000)
+	for i := 0; i < 200; i++ {
+		if err := db.Insert(fmt.Sprintf("k%03d", i), Document[:i*20]); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for i := 0; i < 200; i += 2 {
+		if err := db.Delete(fmt.Sprintf("k%03d", i)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	Records, err := db.Scan("k", PrefixEnd("k"))
+	if err != nil || len(Records) != 100 {
+		t.Fatalf("Scan returned %d records, %v", len(Records), err)
+	}
+	if Records[5].Fields[1] != Document[:11*20] {
+		t.Fatalf("k011 holds %d bytes, want %d", len(Records[5].Fields[1]), 11*20)
+	}
+	if _, err := os.Stat(MemoryFilePath); err == nil {
+		t.Fatalf("in-memory database created a %s file", MemoryFilePath)
+	}
+}
+
+func TestMemoryPageStoreEnforcesPageSize(t *testing.T) {
+	var Store *MemoryPageStore = NewMemoryPageStore(512)
+	Page, err := Store.AllocatePage()
+	if err != nil {
+		t.Fatal(err)
+	}
+	Page.Data["x"] = strings.Repeat("a", 1000)
+	if err := Store.WritePage(Page); err == nil {
+		t.Fatal("WritePage accepted a page larger than the page size")
+	}
+	if err := Store.FreePage(Page.Header.PageID); err != nil {
+		t.Fatal(err)
+	}
+	if !Store.IsDeallocated(Page.Header.PageID) {
+		t.Fatal("freed page is not on the free list")
+	}
+	Reused, err := Store.AllocatePage()
+	if err != nil || Reused.Header.PageID != Page.Header.PageID {
+		t.Fatalf("AllocatePage returned page %d, %v instead of reusing page %d", Reused.Header.PageID, err, Page.Header.PageID)
+	}
+}
@@ -0,0 +1,171 @@
+package storage
+
+import (
+	"fmt"
+	"strconv"
+)
+
+// MetaPageID is the page that records where the index lives. It is always the first
+// page of the file so it can be found without any other information.
+const MetaPageID uint = 1
+
+// IndexFormatVersion is the version of the index layout recorded in the metadata page.
+const IndexFormatVersion = 1
+
+// createTree creates an empty tree whose metadata goes on whichever page the store
+// allocates next, for the extra trees of a file that holds more than one.
+func createTree(Store PageStore, Order int) (*BPlusTree, error) {
+	tree := &BPlusTree{Order: Order, Store: Store}
+	if err := tree.checkOrder(); err != nil {
+		return nil, err
+	}
+	if err := tree.create(); err != nil {
+		return nil, err
+	}
+	return tree, nil
+}
+
+// openTree opens the tree whose metadata is on MetaPageID.
+func openTree(Store PageStore, MetaPageID uint) (*BPlusTree, error) {
+	MetaPage, err := Store.ReadPage(MetaPageID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read index metadata: %w", err)
+	}
+	if MetaPage.Header.PageType != "Meta" {
+		return nil, fmt.Errorf("page %d is a %s page, expected index metadata", MetaPageID, MetaPage.Header.PageType)
+	}
+	tree := &BPlusTree{MetaPageID: MetaPageID, Store: Store}
+	if err := tree.loadMeta(MetaPage); err != nil {
+		return nil, err
+	}
+	tree.keyLimit = tree.fixedKeyLimit()
+	return tree, nil
+}
+
+// create writes the metadata page and an empty root leaf for a brand new tree. A
+// tree without a MetaPageID keeps its metadata on the first page it allocates.
+func (tree *BPlusTree) create() error {
+	MetaPage, err := tree.Store.AllocatePage()
+	if err != nil {
+		return err
+	}
+	if tree.MetaPageID == 0 {
+		tree.MetaPageID = MetaPage.Header.PageID
+	}
+	if MetaPage.Header.PageID != tree.MetaPageID {
+		return fmt.Errorf("expected metadata on page %d, allocated page %d", tree.MetaPageID, MetaPage.Header.PageID)
+	}
+	MetaPage.Header.PageType = "Meta"
+	if err := tree.Store.WritePage(MetaPage); err != nil {
+		return err
+	}
+
+	RootPage, err := tree.Store.AllocatePage()
+	if err != nil {
+		return err
+	}
+	RootPage.Header.PageType = "Index"
+	if err := tree.writeNode(&BTreeNode{Page: RootPage, IsLeaf: true}); err != nil {
+		return err
+	}
+
+	tree.RootPageID = RootPage.Header.PageID
+	tree.Height = 1
+	tree.KeyCount = 0
+	return tree.writeMeta()
+}
+
+// loadMeta restores the tree's root, height and key count from its metadata page.
+func (tree *BPlusTree) loadMeta(MetaPage *Page) error {
+	Version, err := strconv.Atoi(MetaPage.Data["FormatVersion"])
+	if err != nil {
+		return fmt.Errorf("corrupt index metadata: missing format version")
+	}
+	if Version > IndexFormatVersion {
+		return fmt.Errorf("index format version %d is newer than supported version %d", Version, IndexFormatVersion)
+	}
+
+	RootPageID, err := strconv.ParseUint(MetaPage.Data["RootPageID"], 10, 32)
+	if err != nil || RootPageID == 0 {
+		return fmt.Errorf("corrupt index metadata: invalid root page '%s'", MetaPage.Data["RootPageID"])
+	}
+	Height, err := strconv.ParseUint(MetaPage.Data["TreeHeight"], 10, 32)
+	if err != nil {
+		return fmt.Errorf("corrupt index metadata: invalid tree height '%s'", MetaPage.Data["TreeHeight"])
+	}
+	KeyCount, err := strconv.ParseUint(MetaPage.Data["KeyCount"], 10, 64)
+	if err != nil {
+		return fmt.Errorf("corrupt index metadata: invalid key count '%s'", MetaPage.Data["KeyCount"])
+	}
+
+	// Trees written before the order was recorded always used BTreeOrder.
+	tree.Order = BTreeOrder
+	if Order, KeyExists := MetaPage.Data["BTreeOrder"]; KeyExists {
+		if tree.Order, err = strconv.Atoi(Order); err != nil || tree.Order < 0 {
+			return fmt.Errorf("corrupt index metadata: invalid order '%s'", Order)
+		}
+	}
+
+	tree.RootPageID = uint(RootPageID)
+	tree.Height = uint(Height)
+	tree.KeyCount = KeyCount
+	return nil
+}
+
+// writeMeta records the tree's current root, height and key count. The metadata is a
+// single page, so a root change becomes visible in one page write.
+func (tree *BPlusTree) writeMeta() error {
+	MetaPage, err := tree.Store.ReadPage(tree.MetaPageID)
+	if err != nil {
+		return err
+	}
+	MetaPage.Data["FormatVersion"] = strconv.Itoa(IndexFormatVersion)
+	MetaPage.Data["RootPageID"] = strconv.FormatUint(uint64(tree.RootPageID), 10)
+	MetaPage.Data["TreeHeight"] = strconv.FormatUint(uint64(tree.Height), 10)
+	MetaPage.Data["KeyCount"] = strconv.FormatUint(tree.KeyCount, 10)
+	MetaPage.Data["BTreeOrder"] = strconv.Itoa(tree.Order)
+	return tree.Store.WritePage(MetaPage)
+}
+
+// upgradeLegacyRoot converts a file from before the metadata page existed, where the
+// root was always page 1. The old root is copied to a fresh page so that page 1 can
+// hold the metadata, and the height and key count are measured from the tree.
+func (tree *BPlusTree) upgradeLegacyRoot(OldRoot *Page) error {
+	RootPage, err := tree.Store.AllocatePage()
+	if err != nil {
+		return err
+	}
+	RootPage.Header.PageType = "Index"
+	for Key, Value := range OldRoot.Data {
+		RootPage.Data[Key] = Value
+	}
+	if err := tree.Store.WritePage(RootPage); err != nil {
+		return err
+	}
+	tree.RootPageID = RootPage.Header.PageID
+	tree.Order = BTreeOrder
+
+	Node, err := tree.readNode(tree.RootPageID)
+	for tree.Height = 1; err == nil && !Node.IsLeaf; tree.Height++ {
+		Node, err = tree.readNode(Node.Children[0])
+	}
+	if err != nil {
+		return err
+	}
+	var Cursor *Cursor = tree.Cursor()
+	for ok := Cursor.First(); ok; ok = Cursor.Next() {
+		tree.KeyCount++
+	}
+	if err := Cursor.Err(); err != nil {
+		return err
+	}
+
+	var MetaPage *Page = &Page{
+		Header: PageHeader{PageID: tree.MetaPageID, PageType: "Meta"},
+		Data:   make(map[string]string),
+	}
+	if err := tree.Store.WritePage(MetaPage); err != nil {
+		return err
+	}
+	return tree.writeMeta()
+}
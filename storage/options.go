@@ -0,0 +1,105 @@
+package storage
+
+import "fmt"
+
+// Options holds the settings OpenDatabase uses to create or open a database.
+type Options struct {
+	// BTreeOrder is the maximum number of children per index node for a new database.
+	// Zero sizes nodes to fill their pages instead. An existing database keeps the
+	// order it was created with. Keys are limited so that a full node still fits in
+	// a page, and an order too large for the page size is rejected.
+	BTreeOrder int
+
+	// Format selects the file format of a new database. Existing files are always
+	// opened in the format they were written in.
+	Format StorageFormat
+
+	// PageStore, if set, is used instead of opening a file, and FilePath is ignored.
+	PageStore PageStore
+
+	// BufferPoolFrames is the number of pages cached in memory in front of the page
+	// store. Zero disables the cache.
+	BufferPoolFrames int
+
+	// SyncMode controls when pages and the write-ahead log are synced to disk.
+	SyncMode SyncMode
+
+	// CheckpointLogSize is the size in bytes the write-ahead log may grow to before
+	// a commit triggers a checkpoint. Zero disables automatic checkpoints.
+	CheckpointLogSize int64
+}
+
+// DefaultCheckpointLogSize is the log size that triggers a checkpoint unless
+// WithAutoCheckpoint says otherwise.
+const DefaultCheckpointLogSize int64 = 4 << 20
+
+// Option changes one setting in Options.
+type Option func(*Options)
+
+// WithBTreeOrder creates the index with a fixed order instead of filling pages.
+func WithBTreeOrder(Order int) Option {
+	return func(Options *Options) {
+		Options.BTreeOrder = Order
+	}
+}
+
+// WithFormat creates new database files in the given format.
+func WithFormat(Format StorageFormat) Option {
+	return func(Options *Options) {
+		Options.Format = Format
+	}
+}
+
+// WithPageStore opens the database on an existing PageStore instead of a file.
+func WithPageStore(Store PageStore) Option {
+	return func(Options *Options) {
+		Options.PageStore = Store
+	}
+}
+
+// WithBufferPool caches the given number of pages in memory. Zero disables the cache.
+func WithBufferPool(Frames int) Option {
+	return func(Options *Options) {
+		Options.BufferPoolFrames = Frames
+	}
+}
+
+// WithSyncMode sets when pages and the write-ahead log are synced to disk.
+func WithSyncMode(Mode SyncMode) Option {
+	return func(Options *Options) {
+		Options.SyncMode = Mode
+	}
+}
+
+// WithAutoCheckpoint checkpoints after any commit that leaves the write-ahead log
+// larger than LogBytes. Zero disables automatic checkpoints.
+func WithAutoCheckpoint(LogBytes int64) Option {
+	return func(Options *Options) {
+		Options.CheckpointLogSize = LogBytes
+	}
+}
+
+// buildOptions applies Opts over the defaults and validates the result.
+func buildOptions(Opts []Option) (*Options, error) {
+	var Result *Options = &Options{
+		BufferPoolFrames:  DefaultBufferPoolFrames,
+		CheckpointLogSize: DefaultCheckpointLogSize,
+	}
+	for _, Opt := range Opts {
+		Opt(Result)
+	}
+
+	if Result.BTreeOrder != 0 && Result.BTreeOrder < 3 {
+		return nil, fmt.Errorf("B+ tree order must be at least 3, got %d", Result.BTreeOrder)
+	}
+	if Result.BufferPoolFrames < 0 {
+		return nil, fmt.Errorf("buffer pool frame count cannot be negative, got %d", Result.BufferPoolFrames)
+	}
+	if Result.SyncMode < SyncNormal || Result.SyncMode > SyncOff {
+		return nil, fmt.Errorf("unknown sync mode %d", Result.SyncMode)
+	}
+	if Result.CheckpointLogSize < 0 {
+		return nil, fmt.Errorf("checkpoint log size cannot be negative, got %d", Result.CheckpointLogSize)
+	}
+	return Result, nil
+}
@@ -0,0 +1,145 @@
+package storage
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+)
+
+// Records larger than maxInlineRecordSize are written to a chain of "Overflow" pages.
+// Each overflow page holds one "Chunk" of the record's encoded fields and the PageID
+// of the next page in "NextPage", with 0 ending the chain. The data page keeps only
+// an "Overflow-N" slot pointing at the first page.
+
+// maxInlineRecordSize is the largest record stored directly on a data page, chosen so
+// that a data page still has room for other records next to it.
+func (db *Database) maxInlineRecordSize() int {
+	return db.Store.PageSize() / 2
+}
+
+// readRecord reads a record from a data page, following its overflow chain if the
+// record was spilled.
+func (db *Database) readRecord(DataPage *Page, EntryIndex uint) (*Record, error) {
+	var FirstPageID uint = DataPage.OverflowPageID(EntryIndex)
+	if FirstPageID == 0 {
+		return DataPage.GetRecord(EntryIndex)
+	}
+
+	Encoded, err := db.readOverflow(FirstPageID)
+	if err != nil {
+		return nil, err
+	}
+	return &Record{
+		EntryIndex: EntryIndex,
+		Fields:     splitEscaped(Encoded, FieldSeparator),
+	}, nil
+}
+
+// deleteRecord removes a record from a data page and frees its overflow chain.
+// The caller writes the data page.
+func (db *Database) deleteRecord(DataPage *Page, EntryIndex uint) error {
+	var PageID uint = DataPage.OverflowPageID(EntryIndex)
+	if err := DataPage.DeleteRecord(EntryIndex); err != nil {
+		return err
+	}
+
+	for PageID != 0 {
+		OverflowPage, err := db.readOverflowPage(PageID)
+		if err != nil {
+			return err
+		}
+		if err := db.Store.FreePage(PageID); err != nil {
+			return err
+		}
+		PageID = overflowNext(OverflowPage)
+	}
+	return nil
+}
+
+// writeOverflow writes Encoded across as many overflow pages as it needs and returns
+// the PageID of the first one.
+func (db *Database) writeOverflow(Encoded string) (uint, error) {
+	var Chunks []string
+	for len(Encoded) > 0 {
+		var Length int = db.overflowChunkLength(Encoded)
+		if Length == 0 {
+			return 0, fmt.Errorf("page size %d is too small for overflow pages", db.Store.PageSize())
+		}
+		Chunks = append(Chunks, Encoded[:Length])
+		Encoded = Encoded[Length:]
+	}
+
+	var Pages []*Page = make([]*Page, len(Chunks))
+	for i := range Chunks {
+		OverflowPage, err := db.Store.AllocatePage()
+		if err != nil {
+			return 0, err
+		}
+		OverflowPage.Header.PageType = "Overflow"
+		Pages[i] = OverflowPage
+	}
+	for i, OverflowPage := range Pages {
+		var NextPageID uint = 0
+		if i+1 < len(Pages) {
+			NextPageID = Pages[i+1].Header.PageID
+		}
+		OverflowPage.Data["Chunk"] = Chunks[i]
+		OverflowPage.Data["NextPage"] = strconv.FormatUint(uint64(NextPageID), 10)
+		if err := db.Store.WritePage(OverflowPage); err != nil {
+			return 0, err
+		}
+	}
+	return Pages[0].Header.PageID, nil
+}
+
+// readOverflow concatenates the chunks of the chain starting at PageID.
+func (db *Database) readOverflow(PageID uint) (string, error) {
+	var Encoded []byte
+	for PageID != 0 {
+		OverflowPage, err := db.readOverflowPage(PageID)
+		if err != nil {
+			return "", err
+		}
+		Encoded = append(Encoded, OverflowPage.Data["Chunk"]...)
+		PageID = overflowNext(OverflowPage)
+	}
+	return string(Encoded), nil
+}
+
+// readOverflowPage reads a page and checks that it belongs to an overflow chain.
+func (db *Database) readOverflowPage(PageID uint) (*Page, error) {
+	OverflowPage, err := db.Store.ReadPage(PageID)
+	if err != nil {
+		return nil, err
+	}
+	if OverflowPage.Header.PageType != "Overflow" {
+		return nil, fmt.Errorf("page %d is a %s page, expected an overflow page", PageID, OverflowPage.Header.PageType)
+	}
+	return OverflowPage, nil
+}
+
+// overflowChunkLength returns how many bytes from the start of Encoded fit in one
+// overflow page once the text format has escaped them.
+func (db *Database) overflowChunkLength(Encoded string) int {
+	var Empty *Page = &Page{
+		Header: PageHeader{PageID: math.MaxUint32, PageLSN: math.MaxUint64, PageType: "Overflow"},
+		Data: map[string]string{
+			"Chunk":    "",
+			"NextPage": strconv.FormatUint(math.MaxUint32, 10),
+		},
+	}
+	var Room int = db.Store.PageSize() - Empty.Size()
+
+	// Escaping never shrinks a prefix, so the fitting lengths form a prefix of [0, len].
+	return sort.Search(len(Encoded)+1, func(Length int) bool {
+		return len(escapeValue(Encoded[:Length], "")) > Room
+	}) - 1
+}
+
+// overflowNext returns the next PageID in an overflow chain, or 0 at the end.
+func overflowNext(OverflowPage *Page) uint {
+	var NextPageID uint = 0
+	fmt.Sscanf(OverflowPage.Data["NextPage"], "%d", &NextPageID)
+	return NextPageID
+}
@@ -0,0 +1,56 @@
+package storage
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestOverflowRecords(t *testing.T) {
+	for _, Format := range fileFormats {
+		var Path string = testPath(t)
+		var Document string = strings.Repeat("lorem|ipsum\n\\", 3000) + "\xff\x00"
+		db := openTest(t, Path, WithFormat(Format))
+		if err := db.Insert("doc", Document); err != nil {
+			t.Fatalf("%v: Insert of a spilled record: %v", Format, err)
+		}
+		if err := db.Insert("small", "s"); err != nil {
+			t.Fatal(err)
+		}
+		if err := db.Close(); err != nil {
+			t.Fatal(err)
+		}
+
+		db = openTest(t, Path)
+		Record, err := db.Get("doc")
+		if err != nil || Record == nil || Record.Fields[0] != "doc" || Record.Fields[1] != Document {
+			t.Fatalf("%v: spilled record did not read back: %v", Format, err)
+		}
+
+		// Growing a record spills it; shrinking it frees its overflow chain.
+		if err := db.Update("small", Document+Document); err != nil {
+			t.Fatal(err)
+		}
+		var PageCount uint = db.Store.PageCount()
+		if err := db.Update("doc", "tiny"); err != nil {
+			t.Fatal(err)
+		}
+		if Record, _ := db.Get("doc"); Record == nil || Record.Fields[1] != "tiny" {
+			t.Fatalf("%v: shrunk record = %v", Format, Record)
+		}
+		if Record, _ := db.Get("small"); Record == nil || Record.Fields[1] != Document+Document {
+			t.Fatalf("%v: grown record did not read back", Format)
+		}
+		if err := db.Delete("small"); err != nil {
+			t.Fatal(err)
+		}
+
+		// The freed overflow pages are reused before the file grows.
+		if err := db.Insert("again", Document+Document); err != nil {
+			t.Fatal(err)
+		}
+		if db.Store.PageCount() > PageCount {
+			t.Fatalf("%v: page count grew from %d to %d", Format, PageCount, db.Store.PageCount())
+		}
+		db.Close()
+	}
+}
@@ -1,18 +1,97 @@
 package storage
 
 import (
+	"errors"
 	"fmt"
+	"slices"
+	"strconv"
 	"strings"
 )
 
+// PageHeader contains metadata for a page.
+type PageHeader struct {
+	PageLSN  uint64
+	PageID   uint
+	PageType string
+}
+
+// Page represents a single page in the database file, which can hold data, index nodes, etc.
+type Page struct {
+	Header PageHeader
+	Data   map[string]string
+}
+
+// clone returns a deep copy of the page.
+func (self *Page) clone() *Page {
+	var Copy *Page = &Page{
+		Header: self.Header,
+		Data:   make(map[string]string, len(self.Data)),
+	}
+	for Key, Value := range self.Data {
+		Copy.Data[Key] = Value
+	}
+	return Copy
+}
+
+// ErrPageFull is returned when a record does not fit in the space left on a page.
+var ErrPageFull = errors.New("page is full")
+
+// ErrPageOverflow is returned when a page is larger than the database's page size.
+var ErrPageOverflow = errors.New("page exceeds page size")
+
+// ErrPageNotFound is returned when reading a page that was allocated but never
+// written, or that did not exist yet at a snapshot.
+var ErrPageNotFound = errors.New("page not found")
+
+// ErrRecordOverflow is returned by GetRecord for a record whose fields were spilled
+// into overflow pages. Database reads follow the chain transparently.
+var ErrRecordOverflow = errors.New("record is stored in overflow pages")
+
 // Record represents a single row or entry in a data page.
 type Record struct {
 	EntryIndex uint
 	Fields     []string
 }
 
-// AddRecord adds a new record to a data page.
-func (self *Page) AddRecord(Record *Record) (uint, error) {
+// Size estimates how many bytes the record adds to a data page, including its slot.
+func (self *Record) Size() int {
+	return len(escapeValue(joinEscaped(self.Fields, FieldSeparator), "")) + len("Entry-: \n") + 10
+}
+
+// Data pages are slotted: each record lives under its own "Entry-N" slot, and the
+// "EntryIndex" counter only ever grows so that a slot number is never reused for a
+// different record while an index may still point at it. A record too large for a
+// data page takes an "Overflow-N" slot instead, holding the first page of its chain.
+
+// Size returns the number of bytes the page takes up when written to the database file.
+func (self *Page) Size() int {
+	return len(formatPage(self))
+}
+
+// FreeSpace returns how many more bytes the page can hold before it exceeds PageSize.
+func (self *Page) FreeSpace(PageSize int) int {
+	return max(PageSize-self.Size(), 0)
+}
+
+// AddRecord adds a new record to a data page. It returns ErrPageFull, leaving the
+// page unchanged, if the record would not fit within PageSize.
+func (self *Page) AddRecord(Record *Record, PageSize int) (uint, error) {
+	EntryIndex, err := self.addEntry("Entry", joinEscaped(Record.Fields, FieldSeparator), PageSize)
+	if err != nil {
+		return 0, err
+	}
+	Record.EntryIndex = EntryIndex
+	return EntryIndex, nil
+}
+
+// AddOverflowRecord adds a slot for a record whose fields are stored in a chain of
+// overflow pages starting at FirstPageID.
+func (self *Page) AddOverflowRecord(FirstPageID uint, PageSize int) (uint, error) {
+	return self.addEntry("Overflow", fmt.Sprintf("%d", FirstPageID), PageSize)
+}
+
+// addEntry stores Value under the next slot number with the given key prefix.
+func (self *Page) addEntry(Prefix string, Value string, PageSize int) (uint, error) {
 	if self.Header.PageType != "Data" {
 		return 0, fmt.Errorf("Not a Data Page")
 	}
@@ -23,13 +102,53 @@ func (self *Page) AddRecord(Record *Record) (uint, error) {
 	}
 
 	EntryIndex++
+	var EntryKey string = fmt.Sprintf("%s-%d", Prefix, EntryIndex)
+	var OldEntryIndex, HadEntryIndex = self.Data["EntryIndex"]
+
 	self.Data["EntryIndex"] = fmt.Sprintf("%d", EntryIndex)
+	self.Data[EntryKey] = Value
 
+	if self.Size() > PageSize {
+		delete(self.Data, EntryKey)
+		if HadEntryIndex {
+			self.Data["EntryIndex"] = OldEntryIndex
+		} else {
+			delete(self.Data, "EntryIndex")
+		}
+		return 0, ErrPageFull
+	}
+	return EntryIndex, nil
+}
+
+// OverflowPageID returns the first overflow page of a spilled record, or 0 if the
+// record is stored inline or does not exist.
+func (self *Page) OverflowPageID(EntryIndex uint) uint {
+	var PageID uint = 0
+	if Value, KeyExists := self.Data[fmt.Sprintf("Overflow-%d", EntryIndex)]; KeyExists {
+		fmt.Sscanf(Value, "%d", &PageID)
+	}
+	return PageID
+}
+
+// UpdateRecord replaces the fields of an existing record in place. It returns
+// ErrPageFull, leaving the page unchanged, if the new fields would not fit.
+func (self *Page) UpdateRecord(EntryIndex uint, Record *Record, PageSize int) error {
+	if self.Header.PageType != "Data" {
+		return fmt.Errorf("Not a data page")
+	}
 	var EntryKey string = fmt.Sprintf("Entry-%d", EntryIndex)
-	self.Data[EntryKey] = strings.Join(Record.Fields, "|")
+	var OldRecordString, RecordExists = self.Data[EntryKey]
+	if !RecordExists {
+		return fmt.Errorf("Record to update not found on page: EntryIndex %d", EntryIndex)
+	}
 
+	self.Data[EntryKey] = joinEscaped(Record.Fields, FieldSeparator)
+	if self.Size() > PageSize {
+		self.Data[EntryKey] = OldRecordString
+		return ErrPageFull
+	}
 	Record.EntryIndex = EntryIndex
-	return EntryIndex, nil
+	return nil
 }
 
 // GetRecord retrieves a record by its index from a data page.
@@ -44,21 +163,59 @@ func (self *Page) GetRecord(EntryIndex uint) (*Record, error) {
 	RecordString, RecordExists = self.Data[EntryKey]
 
 	if !RecordExists {
+		if self.OverflowPageID(EntryIndex) != 0 {
+			return nil, fmt.Errorf("%w: EntryIndex %d", ErrRecordOverflow, EntryIndex)
+		}
 		return nil, fmt.Errorf("Record not found on page: EntryIndex %d", EntryIndex)
 	}
 
 	return &Record{
 		EntryIndex: EntryIndex,
-		Fields:     strings.Split(RecordString, "|"),
+		Fields:     splitEscaped(RecordString, FieldSeparator),
 	}, nil
 }
 
+// RecordCount returns how many records, inline or spilled, a data page holds.
+func (self *Page) RecordCount() int {
+	var Count int = 0
+	for Key := range self.Data {
+		if strings.HasPrefix(Key, "Entry-") || strings.HasPrefix(Key, "Overflow-") {
+			Count++
+		}
+	}
+	return Count
+}
+
+// EntryIndexes returns the EntryIndex of every record, inline or spilled, on a data
+// page, in ascending order.
+func (self *Page) EntryIndexes() []uint {
+	var EntryIndexes []uint
+	for Key := range self.Data {
+		var Suffix string
+		var IsRecord bool
+		if Suffix, IsRecord = strings.CutPrefix(Key, "Entry-"); !IsRecord {
+			Suffix, IsRecord = strings.CutPrefix(Key, "Overflow-")
+		}
+		if !IsRecord {
+			continue
+		}
+		if EntryIndex, err := strconv.ParseUint(Suffix, 10, 32); err == nil {
+			EntryIndexes = append(EntryIndexes, uint(EntryIndex))
+		}
+	}
+	slices.Sort(EntryIndexes)
+	return EntryIndexes
+}
+
 // DeleteRecord removes a record from a page.
 func (self *Page) DeleteRecord(EntryIndex uint) error {
 	if self.Header.PageType != "Data" {
 		return fmt.Errorf("Not a data page")
 	}
 	var EntryKey string = fmt.Sprintf("Entry-%d", EntryIndex)
+	if _, exists := self.Data[EntryKey]; !exists {
+		EntryKey = fmt.Sprintf("Overflow-%d", EntryIndex)
+	}
 	if _, exists := self.Data[EntryKey]; !exists {
 		return fmt.Errorf("Record to delete not found on page: EntryIndex %d", EntryIndex)
 	}
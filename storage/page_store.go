@@ -0,0 +1,190 @@
+package storage
+
+import (
+	"fmt"
+	"io"
+	"os"
+)
+
+const DefaultPageSize int = 4096 // bytes
+
+// PageStore is the page-level storage that Database and BPlusTree are built on.
+// Pages are numbered from 1; TextFileHandler and BinaryFileHandler are the two
+// file-backed implementations.
+type PageStore interface {
+	// ReadPage returns a copy of the page with the given ID.
+	ReadPage(PageID uint) (*Page, error)
+	// WritePage stores the page under its Header.PageID. It returns ErrPageOverflow
+	// if the page does not fit in PageSize.
+	WritePage(Page *Page) error
+	// AllocatePage reserves a page ID, reusing a freed one if there is any, and
+	// returns an empty page for it. The page is not stored until it is written.
+	AllocatePage() (*Page, error)
+	// FreePage makes a page ID available to AllocatePage again.
+	FreePage(PageID uint) error
+	// PageSize returns the size of a page in bytes.
+	PageSize() int
+	// PageCount returns the highest PageID allocated so far.
+	PageCount() uint
+	// Sync commits everything written so far to stable storage.
+	Sync() error
+	// Close releases the store's resources.
+	Close() error
+}
+
+// Checkpointer is implemented by page stores that record the LSN of the last
+// checkpoint in their file header, next to the page count.
+type Checkpointer interface {
+	// CheckpointLSN returns the LSN recorded by the last checkpoint, or 0.
+	CheckpointLSN() uint64
+	// SetCheckpointLSN records a checkpoint and syncs it to stable storage.
+	SetCheckpointLSN(LSN uint64) error
+}
+
+// checkpointerOf returns the Checkpointer behind Store, looking through a buffer
+// pool, if the store records checkpoints.
+func checkpointerOf(Store PageStore) (Checkpointer, bool) {
+	if Pool, Buffered := Store.(*BufferPool); Buffered {
+		Store = Pool.Store
+	}
+	Checkpointer, Supported := Store.(Checkpointer)
+	return Checkpointer, Supported
+}
+
+// FreeList is implemented by page stores that keep a list of deallocated pages.
+// A freed page keeps its old contents until it is reused, so readers that walk
+// pages by ID rather than through an index check it to skip them.
+type FreeList interface {
+	// IsDeallocated reports whether a page is on the deallocated list.
+	IsDeallocated(PageID uint) bool
+}
+
+// freeListOf returns the FreeList behind Store, looking through a buffer pool, if
+// the store keeps one.
+func freeListOf(Store PageStore) (FreeList, bool) {
+	if Pool, Buffered := Store.(*BufferPool); Buffered {
+		Store = Pool.Store
+	}
+	FreeList, Supported := Store.(FreeList)
+	return FreeList, Supported
+}
+
+// StorageFormat selects the PageStore implementation OpenDatabase creates.
+type StorageFormat int
+
+const (
+	// BinaryFormat stores fixed-size pages in a BinaryFileHandler.
+	BinaryFormat StorageFormat = iota
+	// TextFormat stores pages in a human-readable TextFileHandler, for debugging.
+	TextFormat
+	// MemoryFormat keeps pages in a MemoryPageStore and never touches the filesystem.
+	MemoryFormat
+)
+
+// openPageStore opens the PageStore selected by Options and wraps it in a
+// LoggedStore. Stores that are not already in memory get a buffer pool in front of
+// them, and database files get a write-ahead log next to them, at FilePath with
+// WALSuffix appended.
+func openPageStore(FilePath string, Options *Options) (*LoggedStore, error) {
+	Store, err := openBackingStore(FilePath, Options)
+	if err != nil {
+		return nil, err
+	}
+	_, InMemory := Store.(*MemoryPageStore)
+
+	var Pool *BufferPool
+	if !InMemory && Options.BufferPoolFrames > 0 {
+		if Pool, err = NewBufferPool(Store, Options.BufferPoolFrames); err != nil {
+			Store.Close()
+			return nil, err
+		}
+		Store = Pool
+	}
+	if InMemory || Options.PageStore != nil {
+		return NewLoggedStore(Store, nil), nil
+	}
+
+	WAL, err := openLogFor(FilePath+WALSuffix, Store)
+	if err != nil {
+		Store.Close()
+		return nil, err
+	}
+	WAL.SyncMode = Options.SyncMode
+	if Pool != nil {
+		Pool.Log = WAL
+	}
+	return NewLoggedStore(Store, WAL), nil
+}
+
+// openLogFor opens the write-ahead log of Store. A new log for an existing file
+// starts after its last checkpoint and the highest PageLSN in it, so that LSNs
+// never go backwards. So does a log left without a complete header by a crash
+// while it was being created or emptied.
+func openLogFor(LogPath string, Store PageStore) (*WriteAheadLog, error) {
+	var StartLSN uint64 = 1
+	if Info, err := os.Stat(LogPath); os.IsNotExist(err) || (err == nil && Info.Size() < int64(walHeaderSize)) {
+		if Checkpointer, Supported := checkpointerOf(Store); Supported {
+			StartLSN = Checkpointer.CheckpointLSN() + 1
+		}
+		for PageID := uint(1); PageID <= Store.PageCount(); PageID++ {
+			if Page, err := Store.ReadPage(PageID); err == nil {
+				StartLSN = max(StartLSN, Page.Header.PageLSN+1)
+			}
+		}
+	}
+	return OpenWriteAheadLog(LogPath, StartLSN)
+}
+
+// openBackingStore opens the PageStore selected by Options. An existing file is
+// opened in whichever format it was written in; the format option only applies to
+// new files. The path ":memory:" always selects an in-memory store.
+func openBackingStore(FilePath string, Options *Options) (PageStore, error) {
+	if Options.PageStore != nil {
+		return Options.PageStore, nil
+	}
+	if FilePath == MemoryFilePath || Options.Format == MemoryFormat {
+		return NewMemoryPageStore(DefaultPageSize), nil
+	}
+
+	var Format StorageFormat = Options.Format
+	if File, Error := os.Open(FilePath); Error == nil {
+		var Magic []byte = make([]byte, len(BinaryFileMagic))
+		_, Error = io.ReadFull(File, Magic)
+		File.Close()
+		if Error == nil && string(Magic) == BinaryFileMagic {
+			Format = BinaryFormat
+		} else {
+			Format = TextFormat
+		}
+	}
+
+	switch Format {
+	case BinaryFormat:
+		FileHandler, Error := NewBinaryFileHandler(FilePath)
+		if Error != nil {
+			return nil, Error
+		}
+		FileHandler.SyncMode = Options.SyncMode
+		return FileHandler, nil
+	case TextFormat:
+		FileHandler, Error := NewTextFileHandler(FilePath)
+		if Error != nil {
+			return nil, Error
+		}
+		FileHandler.SyncMode = Options.SyncMode
+		return FileHandler, nil
+	default:
+		return nil, fmt.Errorf("unknown storage format %d", Format)
+	}
+}
+
+var _ PageStore = (*TextFileHandler)(nil)
+var _ PageStore = (*BinaryFileHandler)(nil)
+var _ PageStore = (*MemoryPageStore)(nil)
+var _ PageStore = (*BufferPool)(nil)
+var _ PageStore = (*LoggedStore)(nil)
+var _ Checkpointer = (*TextFileHandler)(nil)
+var _ Checkpointer = (*BinaryFileHandler)(nil)
+var _ FreeList = (*TextFileHandler)(nil)
+var _ FreeList = (*BinaryFileHandler)(nil)
+var _ FreeList = (*MemoryPageStore)(nil)
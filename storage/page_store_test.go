@@ -0,0 +1,77 @@
+package storage
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestDatabaseFormatsReopen(t *testing.T) {
+	var Document string = strings.Repeat("lorem|ipsum\n\\", 1000)
+	for _, Format := range fileFormats {
+		var Path string = testPath(t)
+		db := openTest(t, Path, WithFormat(Format))
+		for i := 0; i < 100; i++ {
+			if err := db.Insert(fmt.Sprintf("k%d", i), Document[:i*100]); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err := db.Close(); err != nil {
+			t.Fatal(err)
+		}
+
+		// The format is detected from the file, not the options.
+		db = openTest(t, Path)
+		if _, IsText := backingStore(db.Store).(*TextFileHandler); IsText != (Format == TextFormat) {
+			t.Fatalf("%v file reopened with handler %T", Format, backingStore(db.Store))
+		}
+		for i := 0; i < 100; i++ {
+			Record, err := db.Get(fmt.Sprintf("k%d", i))
+			if err != nil || Record == nil || Record.Fields[1] != Document[:i*100] {
+				t.Fatalf("%v: Get k%d = %v", Format, i, err)
+			}
+		}
+		db.Close()
+	}
+}
+
+func TestDatabaseReusesFreedPagesAfterReopen(t *testing.T) {
+	var Big string = strings.Repeat("x", 3000)
+	for _, Format := range fileFormats {
+		var Path string = filepath.Join(t.TempDir(), "free.db")
+		db := openTest(t, Path, WithFormat(Format), WithBTreeOrder(4))
+		insertKeys(t, db, "k", 20, Big)
+		var Before uint = db.Log.PageCount()
+		for i := 0; i < 20; i++ {
+			if err := db.Delete(fmt.Sprintf("k%03d", i)); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err := db.Close(); err != nil {
+			t.Fatal(err)
+		}
+
+		db = openTest(t, Path, WithBTreeOrder(4))
+		var Freed []uint
+		switch Store := backingStore(db.Store).(type) {
+		case *TextFileHandler:
+			Freed = Store.DeallocatedPages
+		case *BinaryFileHandler:
+			Freed = Store.DeallocatedPages
+		}
+		if len(Freed) < 20 {
+			t.Fatalf("%v: only %d pages on the free list after reopening", Format, len(Freed))
+		}
+		insertKeys(t, db, "k", 20, Big)
+		if After := db.Log.PageCount(); After != Before {
+			t.Fatalf("%v: page count grew from %d to %d", Format, Before, After)
+		}
+		for i := 0; i < 20; i++ {
+			if Record, err := db.Get(fmt.Sprintf("k%03d", i)); err != nil || Record == nil || Record.Fields[1] != Big {
+				t.Fatalf("%v: Get k%03d: %v", Format, i, err)
+			}
+		}
+		db.Close()
+	}
+}
@@ -0,0 +1,342 @@
+package storage
+
+import "errors"
+
+// RecordIterator walks every record on the data pages of a database as of a
+// snapshot. It reads the pages in PageID order, picking out the "Data" pages, and
+// the records of each page in EntryIndex order, so records come out in the order
+// they are stored rather than by ID. Deleted records and freed pages are skipped,
+// and spilled records are read in full.
+//
+// Table rows live on the same data pages as the records of the main index. Each
+// record is tagged with its owner, found by looking up which index points at its
+// slot: Table returns nil for a record of the main index and the table for a row.
+// Records that no index points at are skipped.
+type RecordIterator struct {
+	Snapshot *ReadTx
+	PageID   uint // Data page of the current record
+	page     *Page
+	entries  []uint // EntryIndexes on the page still to visit
+	record   *Record
+	table    *Table
+	tables   []tableIndex // Primary-key indexes of the tables as of the snapshot
+	owned    bool         // Close ends Snapshot
+	err      error
+}
+
+// tableIndex is a table's primary-key index opened on a snapshot.
+type tableIndex struct {
+	Table *Table
+	Index *BPlusTree
+}
+
+// RowIterator walks the rows of a table in primary-key order as of a snapshot.
+type RowIterator struct {
+	Snapshot *ReadTx
+	Table    *Table
+	cursor   *Cursor
+	started  bool
+	row      Row
+	owned    bool // Close ends Snapshot
+	err      error
+}
+
+// Records returns an iterator over every record and table row as of a snapshot of
+// the latest commit. Close releases the snapshot.
+func (db *Database) Records() (*RecordIterator, error) {
+	Snapshot, err := db.BeginRead()
+	if err != nil {
+		return nil, err
+	}
+	var Iterator *RecordIterator = Snapshot.Records()
+	Iterator.owned = true
+	return Iterator, nil
+}
+
+// Records returns an iterator over every record and table row as of the snapshot.
+func (tx *ReadTx) Records() *RecordIterator {
+	var Iterator *RecordIterator = &RecordIterator{Snapshot: tx}
+	if tx.view.Catalog == nil {
+		return Iterator
+	}
+	tx.view.Catalog.Mutex.RLock()
+	defer tx.view.Catalog.Mutex.RUnlock()
+	for _, Table := range tx.view.Catalog.Tables {
+		Index, err := openTree(tx.view.Store, Table.Index.MetaPageID)
+		if errors.Is(err, ErrPageNotFound) {
+			continue // Created after the snapshot
+		}
+		if err != nil {
+			Iterator.err = err
+			break
+		}
+		Iterator.tables = append(Iterator.tables, tableIndex{Table: Table, Index: Index})
+	}
+	return Iterator
+}
+
+// ForEach calls Visit with every record of the main index, in storage order, as of
+// a snapshot of the latest commit. Table rows are skipped; see Table.ForEach. It
+// stops at the first error Visit returns and returns it. Visit may change the
+// database; the snapshot does not see the changes.
+func (db *Database) ForEach(Visit func(*Record) error) error {
+	Snapshot, err := db.BeginRead()
+	if err != nil {
+		return err
+	}
+	defer Snapshot.Close()
+	return Snapshot.ForEach(Visit)
+}
+
+// ForEach calls Visit with every record of the main index, in storage order, as of
+// the snapshot. Table rows are skipped.
+func (tx *ReadTx) ForEach(Visit func(*Record) error) error {
+	var Iterator *RecordIterator = tx.Records()
+	defer Iterator.Close()
+	for Iterator.Next() {
+		if Iterator.Table() != nil {
+			continue
+		}
+		if err := Visit(Iterator.Record()); err != nil {
+			return err
+		}
+	}
+	return Iterator.Err()
+}
+
+// Next moves to the following record. It returns false once every data page has
+// been read or reading fails; Err tells the two apart.
+func (it *RecordIterator) Next() bool {
+	for {
+		if it.err != nil {
+			return false
+		}
+		if it.Snapshot.done {
+			return it.fail(ErrTxDone)
+		}
+		for len(it.entries) == 0 {
+			if !it.nextPage() {
+				return false
+			}
+		}
+
+		Record, err := it.Snapshot.view.readRecord(it.page, it.entries[0])
+		if err != nil {
+			return it.fail(err)
+		}
+		it.entries = it.entries[1:]
+		Table, Owned, err := it.owner(Record)
+		if err != nil {
+			return it.fail(err)
+		}
+		if Owned {
+			it.record = Record
+			it.table = Table
+			return true
+		}
+	}
+}
+
+// Record returns the current record.
+func (it *RecordIterator) Record() *Record {
+	return it.record
+}
+
+// Table returns the table the current record is a row of, or nil if it is a record
+// of the main index.
+func (it *RecordIterator) Table() *Table {
+	return it.table
+}
+
+// Err returns the error that stopped the iterator, if any.
+func (it *RecordIterator) Err() error {
+	return it.err
+}
+
+// Close releases the snapshot if Database.Records opened it.
+func (it *RecordIterator) Close() {
+	if it.owned {
+		it.Snapshot.Close()
+	}
+}
+
+// nextPage moves to the following data page. Pages that were not allocated at the
+// snapshot are skipped, since a freed page still holds whatever it held before.
+func (it *RecordIterator) nextPage() bool {
+	var Store *snapshotStore = it.Snapshot.view.Store.(*snapshotStore)
+	for it.PageID < Store.PageCount() {
+		it.PageID++
+		Page, err := Store.readAllocated(it.PageID)
+		if errors.Is(err, ErrPageNotFound) {
+			continue
+		}
+		if err != nil {
+			return it.fail(err)
+		}
+		if Page.Header.PageType == "Data" {
+			it.page = Page
+			it.entries = Page.EntryIndexes()
+			return true
+		}
+	}
+	it.page = nil
+	it.record = nil
+	it.table = nil
+	return false
+}
+
+// owner returns the table whose primary-key index points at a record on the current
+// page, or nil if the main index does. It returns false if no index points at it.
+func (it *RecordIterator) owner(Record *Record) (*Table, bool, error) {
+	if len(Record.Fields) > 0 {
+		PointsAt, err := it.pointsAt(it.Snapshot.view.Index, Record.Fields[0], Record.EntryIndex)
+		if err != nil || PointsAt {
+			return nil, PointsAt, err
+		}
+	}
+	for _, Owner := range it.tables {
+		if len(Record.Fields) != len(Owner.Table.Schema.Columns) {
+			continue
+		}
+		Key, err := Owner.Table.keyOf(Record.Fields, Owner.Table.Schema.keyColumn())
+		if err != nil {
+			continue // Not a row of this table
+		}
+		PointsAt, err := it.pointsAt(Owner.Index, Key, Record.EntryIndex)
+		if err != nil || PointsAt {
+			return Owner.Table, PointsAt, err
+		}
+	}
+	return nil, false, nil
+}
+
+// pointsAt reports whether Index maps Key to EntryIndex on the current page.
+func (it *RecordIterator) pointsAt(Index *BPlusTree, Key string, EntryIndex uint) (bool, error) {
+	PageID, Found, err := Index.Find(Key)
+	if errors.Is(err, ErrKeyNotFound) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return PageID == it.PageID && Found == EntryIndex, nil
+}
+
+// fail stops the iterator with err and returns false.
+func (it *RecordIterator) fail(err error) bool {
+	it.err = err
+	it.page = nil
+	it.entries = nil
+	it.record = nil
+	it.table = nil
+	return false
+}
+
+// Rows returns an iterator over the rows of the table as of a snapshot of the
+// latest commit. Close releases the snapshot.
+func (table *Table) Rows() (*RowIterator, error) {
+	Snapshot, err := table.db.BeginRead()
+	if err != nil {
+		return nil, err
+	}
+	Iterator, err := Snapshot.Rows(table)
+	if err != nil {
+		Snapshot.Close()
+		return nil, err
+	}
+	Iterator.owned = true
+	return Iterator, nil
+}
+
+// Rows returns an iterator over the rows of a table as of the snapshot.
+func (tx *ReadTx) Rows(Table *Table) (*RowIterator, error) {
+	if tx.done {
+		return nil, ErrTxDone
+	}
+	Index, err := openTree(tx.view.Store, Table.Index.MetaPageID)
+	if err != nil {
+		return nil, err
+	}
+	return &RowIterator{Snapshot: tx, Table: Table, cursor: Index.Cursor()}, nil
+}
+
+// ForEach calls Visit with every row of the table, in primary-key order, as of a
+// snapshot of the latest commit. It stops at the first error Visit returns and
+// returns it.
+func (table *Table) ForEach(Visit func(Row) error) error {
+	Iterator, err := table.Rows()
+	if err != nil {
+		return err
+	}
+	defer Iterator.Close()
+	for Iterator.Next() {
+		if err := Visit(Iterator.Row()); err != nil {
+			return err
+		}
+	}
+	return Iterator.Err()
+}
+
+// Next moves to the following row. It returns false after the last row or when
+// reading fails; Err tells the two apart.
+func (it *RowIterator) Next() bool {
+	if it.err != nil {
+		return false
+	}
+	if it.Snapshot.done {
+		return it.fail(ErrTxDone)
+	}
+	var Valid bool
+	if it.started {
+		Valid = it.cursor.Next()
+	} else {
+		it.started = true
+		Valid = it.cursor.First()
+	}
+	if !Valid {
+		it.row = nil
+		it.err = it.cursor.Err()
+		return false
+	}
+
+	PageID, EntryIndex, err := it.cursor.Value()
+	if err != nil {
+		return it.fail(err)
+	}
+	DataPage, err := it.Snapshot.view.Store.ReadPage(PageID)
+	if err != nil {
+		return it.fail(err)
+	}
+	Record, err := it.Snapshot.view.readRecord(DataPage, EntryIndex)
+	if err != nil {
+		return it.fail(err)
+	}
+	if it.row, err = it.Table.Schema.decodeRow(Record.Fields); err != nil {
+		return it.fail(err)
+	}
+	return true
+}
+
+// Row returns the current row.
+func (it *RowIterator) Row() Row {
+	return it.row
+}
+
+// Err returns the error that stopped the iterator, if any.
+func (it *RowIterator) Err() error {
+	return it.err
+}
+
+// Close releases the snapshot if Table.Rows opened it.
+func (it *RowIterator) Close() {
+	if it.owned {
+		it.Snapshot.Close()
+	}
+}
+
+// fail stops the iterator with err and returns false.
+func (it *RowIterator) fail(err error) bool {
+	it.err = err
+	it.row = nil
+	return false
+}
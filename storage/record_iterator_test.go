@@ -0,0 +1,242 @@
+package storage
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+// forEachData returns the data of every record ForEach visits, by ID.
+func forEachData(t *testing.T, Visit func(func(*Record) error) error) map[string]string {
+	t.Helper()
+	var Data map[string]string = map[string]string{}
+	err := Visit(func(Record *Record) error {
+		if _, Seen := Data[Record.Fields[0]]; Seen {
+			return fmt.Errorf("record %q visited twice", Record.Fields[0])
+		}
+		Data[Record.Fields[0]] = Record.Fields[1]
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return Data
+}
+
+func checkSameData(t *testing.T, Label string, Got map[string]string, Want map[string]string) {
+	t.Helper()
+	if len(Got) != len(Want) {
+		t.Fatalf("%s: visited %d records, want %d", Label, len(Got), len(Want))
+	}
+	for ID, Data := range Want {
+		if Got[ID] != Data {
+			t.Fatalf("%s: record %s holds %d bytes, want %d", Label, ID, len(Got[ID]), len(Data))
+		}
+	}
+}
+
+func TestForEachVisitsEveryRecord(t *testing.T) {
+	for _, Format := range []StorageFormat{BinaryFormat, TextFormat, MemoryFormat} {
+		var Path string = testPath(t)
+		db := openTest(t, Path, WithFormat(Format), WithBufferPool(4))
+		var Want map[string]string = map[string]string{}
+		for i := 0; i < 400; i++ {
+			var ID, Data string = fmt.Sprintf("k%04d", i), strings.Repeat("v", 50)
+			if i%97 == 0 {
+				Data = strings.Repeat("big", 3000)
+			}
+			if err := db.Insert(ID, Data); err != nil {
+				t.Fatal(err)
+			}
+			Want[ID] = Data
+		}
+		for i := 0; i < 400; i++ {
+			if i%3 != 0 || i < 300 {
+				var ID string = fmt.Sprintf("k%04d", i)
+				if err := db.Delete(ID); err != nil {
+					t.Fatal(err)
+				}
+				delete(Want, ID)
+			}
+		}
+
+		// New records reuse the freed pages; the snapshot must not see them.
+		Snapshot, err := db.BeginRead()
+		if err != nil {
+			t.Fatal(err)
+		}
+		var SnapshotWant map[string]string = map[string]string{}
+		for ID, Data := range Want {
+			SnapshotWant[ID] = Data
+		}
+		for i := 0; i < 200; i++ {
+			var ID, Data string = fmt.Sprintf("n%04d", i), strings.Repeat("n", 500)
+			if err := db.Insert(ID, Data); err != nil {
+				t.Fatal(err)
+			}
+			Want[ID] = Data
+		}
+		checkSameData(t, fmt.Sprintf("%v", Format), forEachData(t, db.ForEach), Want)
+		checkSameData(t, fmt.Sprintf("%v snapshot", Format), forEachData(t, Snapshot.ForEach), SnapshotWant)
+		Snapshot.Close()
+
+		tx, err := db.Begin()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := tx.Insert("rolled", strings.Repeat("r", 5000)); err != nil {
+			t.Fatal(err)
+		}
+		if err := tx.Rollback(); err != nil {
+			t.Fatal(err)
+		}
+		if _, Visited := forEachData(t, db.ForEach)["rolled"]; Visited {
+			t.Fatalf("%v: ForEach visited a rolled-back record", Format)
+		}
+
+		var Stop error = errors.New("stop")
+		var Visits int = 0
+		err = db.ForEach(func(*Record) error {
+			Visits++
+			if Visits == 3 {
+				return Stop
+			}
+			return nil
+		})
+		if err != Stop || Visits != 3 {
+			t.Fatalf("%v: ForEach returned %v after %d visits", Format, err, Visits)
+		}
+		if err := db.Close(); err != nil {
+			t.Fatal(err)
+		}
+		if Format == MemoryFormat {
+			continue
+		}
+
+		db = openTest(t, Path)
+		checkSameData(t, fmt.Sprintf("%v reopened", Format), forEachData(t, db.ForEach), Want)
+		Iterator, err := db.Records()
+		if err != nil {
+			t.Fatal(err)
+		}
+		Iterator.Close()
+		if Iterator.Next() || !errors.Is(Iterator.Err(), ErrTxDone) {
+			t.Fatalf("%v: closed iterator moved on: %v", Format, Iterator.Err())
+		}
+		db.Close()
+	}
+}
+
+func TestRecordsTagsTableRows(t *testing.T) {
+	db, err := OpenInMemory()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	if err := db.Insert("plain", "v"); err != nil {
+		t.Fatal(err)
+	}
+	Users, err := db.CreateTable("users", Schema{Columns: []Column{{"id", Int64Type}, {"name", StringType}, {"ok", BoolType}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := int64(5); i > 0; i-- {
+		if err := Users.Insert(Row{"id": i, "name": "x", "ok": true}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// A row whose fields look like a record of the main index.
+	Pairs, err := db.CreateTable("pairs", Schema{Columns: []Column{{"k", StringType}, {"v", StringType}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := Pairs.Insert(Row{"k": "plain", "v": "other"}); err != nil {
+		t.Fatal(err)
+	}
+	Snapshot, err := db.BeginRead()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer Snapshot.Close()
+	if _, err := db.CreateTable("later", Schema{Columns: []Column{{"k", StringType}}}); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Insert("plain2", "w"); err != nil {
+		t.Fatal(err)
+	}
+
+	var Data map[string]string = forEachData(t, db.ForEach)
+	if len(Data) != 2 || Data["plain"] != "v" || Data["plain2"] != "w" {
+		t.Fatalf("ForEach visited %v, want only the two plain records", Data)
+	}
+	Iterator, err := db.Records()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var Owners map[string]int = map[string]int{}
+	for Iterator.Next() {
+		var Name string
+		if Iterator.Table() != nil {
+			Name = Iterator.Table().Name
+		}
+		Owners[Name]++
+	}
+	Iterator.Close()
+	if Iterator.Err() != nil || Owners[""] != 2 || Owners["users"] != 5 || Owners["pairs"] != 1 {
+		t.Fatalf("Records tagged owners %v, %v", Owners, Iterator.Err())
+	}
+
+	// The snapshot predates plain2 and the later table.
+	if Data := forEachData(t, Snapshot.ForEach); len(Data) != 1 {
+		t.Fatalf("snapshot ForEach visited %v, want only plain", Data)
+	}
+	var SnapshotIterator *RecordIterator = Snapshot.Records()
+	var Rows int = 0
+	for SnapshotIterator.Next() {
+		Rows++
+	}
+	if err := SnapshotIterator.Err(); err != nil || Rows != 7 {
+		t.Fatalf("snapshot Records visited %d records, %v", Rows, err)
+	}
+}
+
+func TestTableRowsInKeyOrder(t *testing.T) {
+	db, err := OpenInMemory()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	Users, err := db.CreateTable("users", Schema{Columns: []Column{{"id", Int64Type}, {"name", StringType}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := int64(5); i > -5; i-- {
+		if err := Users.Insert(Row{"id": i, "name": fmt.Sprint("user ", i)}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := Users.Delete(int64(0)); err != nil {
+		t.Fatal(err)
+	}
+	var IDs []int64
+	err = Users.ForEach(func(Row Row) error {
+		IDs = append(IDs, Row["id"].(int64))
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fmt.Sprint(IDs) != "[-4 -3 -2 -1 1 2 3 4 5]" {
+		t.Fatalf("ForEach visited rows %v", IDs)
+	}
+
+	Iterator, err := Users.Rows()
+	if err != nil {
+		t.Fatal(err)
+	}
+	Iterator.Close()
+	if Iterator.Next() || !errors.Is(Iterator.Err(), ErrTxDone) {
+		t.Fatalf("closed row iterator moved on: %v", Iterator.Err())
+	}
+}
@@ -0,0 +1,122 @@
+package storage
+
+import "slices"
+
+// RecoveryReport describes what OpenDatabase found in the write-ahead log and what
+// it did to bring the database back to a consistent state.
+type RecoveryReport struct {
+	CheckpointLSN uint64   // LSN of the last checkpoint; older records were not replayed
+	LogRecords    int      // Intact records read from the log
+	Committed     int      // Transactions that committed or aborted before the crash
+	Redone        int      // Page images rewritten because the page was older than the log
+	Undone        int      // Page changes rolled back because their transaction never finished
+	RolledBack    []uint64 // IDs of the transactions that were rolled back
+}
+
+// Recover replays the write-ahead log into the store. It runs in three passes:
+//
+//  1. Analysis finds the transactions that began but never committed or aborted.
+//  2. Redo writes the After image of every update since the last checkpoint, from
+//     any transaction, whose page has an older PageLSN than the record, and then
+//     writes the pages back.
+//  3. Undo restores the Before images of the unfinished transactions, newest first,
+//     freeing pages they allocated, and logs an abort for each of them. A page
+//     that a rollback to a savepoint already freed is left alone, since those
+//     frees are not logged.
+//
+// Undo writes are logged like any other write, so a crash during recovery is
+// recovered from the same way.
+func (self *LoggedStore) Recover() (*RecoveryReport, error) {
+	self.Mutex.Lock()
+	defer self.Mutex.Unlock()
+
+	if self.WAL == nil {
+		return &RecoveryReport{}, nil
+	}
+	Records, err := self.WAL.Records()
+	if err != nil {
+		return nil, err
+	}
+	var Report *RecoveryReport = &RecoveryReport{LogRecords: len(Records)}
+	if Checkpointer, Supported := checkpointerOf(self.Store); Supported {
+		Report.CheckpointLSN = Checkpointer.CheckpointLSN()
+	}
+
+	// 1. Analysis
+	var Unfinished map[uint64]bool = make(map[uint64]bool)
+	for _, Record := range Records {
+		switch Record.Type {
+		case LogBegin:
+			Unfinished[Record.TxID] = true
+		case LogCommit, LogAbort:
+			delete(Unfinished, Record.TxID)
+			Report.Committed++
+		}
+	}
+
+	// 2. Redo
+	for _, Record := range Records {
+		if Record.Type != LogUpdate || Record.After == nil || Record.LSN <= Report.CheckpointLSN {
+			continue
+		}
+		if Current, err := self.Store.ReadPage(Record.PageID); err == nil && Current.Header.PageLSN >= Record.LSN {
+			continue
+		}
+		if err := self.Store.WritePage(Record.After.clone()); err != nil {
+			return nil, err
+		}
+		Report.Redone++
+	}
+	if Pool, Buffered := self.Store.(*BufferPool); Buffered && Report.Redone > 0 {
+		// Redone pages may lie past the end of the file, so they are written
+		// before undo frees any of them.
+		if err := Pool.Flush(); err != nil {
+			return nil, err
+		}
+	}
+
+	// 3. Undo
+	for i := len(Records) - 1; i >= 0; i-- {
+		var Record *LogRecord = Records[i]
+		if Record.Type != LogUpdate || !Unfinished[Record.TxID] {
+			continue
+		}
+		self.txID = Record.TxID
+		if Record.Before == nil {
+			err = self.undoAllocate(Record.PageID)
+		} else {
+			err = self.write(Record.Before.clone(), Record.After)
+		}
+		self.endTransaction()
+		if err != nil {
+			return nil, err
+		}
+		Report.Undone++
+	}
+	for TxID := range Unfinished {
+		if _, err := self.append(&LogRecord{TxID: TxID, Type: LogAbort}); err != nil {
+			return nil, err
+		}
+		Report.RolledBack = append(Report.RolledBack, TxID)
+	}
+	slices.Sort(Report.RolledBack)
+
+	if Report.Redone > 0 || Report.Undone > 0 || len(Unfinished) > 0 {
+		if err := self.WAL.FlushAll(); err != nil {
+			return nil, err
+		}
+		if err := self.Store.Sync(); err != nil {
+			return nil, err
+		}
+	}
+	return Report, nil
+}
+
+// undoAllocate frees a page that an unfinished transaction allocated, unless it is
+// already on the deallocated list.
+func (self *LoggedStore) undoAllocate(PageID uint) error {
+	if FreeList, Supported := freeListOf(self.Store); Supported && FreeList.IsDeallocated(PageID) {
+		return nil
+	}
+	return self.Store.FreePage(PageID)
+}
@@ -0,0 +1,136 @@
+package storage
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestRecoveryRedoesCommittedChanges(t *testing.T) {
+	for _, Format := range fileFormats {
+		var Path string = testPath(t)
+		db := openTest(t, Path, WithFormat(Format), WithBufferPool(1000))
+		insertKeys(t, db, "k", 200, "v")
+		// The pool holds every page, so nothing reached the file before the crash.
+		crash(db)
+
+		db = openTest(t, Path)
+		defer db.Close()
+		if db.Recovery.Redone == 0 {
+			t.Fatalf("%v: recovery redid no pages: %+v", Format, *db.Recovery)
+		}
+		for i := 0; i < 200; i++ {
+			if Record, err := db.Get(fmt.Sprintf("k%03d", i)); err != nil || Record == nil {
+				t.Fatalf("%v: k%03d lost: %v", Format, i, err)
+			}
+		}
+	}
+}
+
+func TestRecoveryUndoesUnfinishedTransaction(t *testing.T) {
+	for _, Format := range fileFormats {
+		var Path string = testPath(t)
+		db := openTest(t, Path, WithFormat(Format), WithBufferPool(1000))
+		insertKeys(t, db, "k", 200, "v")
+
+		// Place a record without indexing or committing it, and let its page reach
+		// the file before the crash.
+		if err := db.Log.Begin(); err != nil {
+			t.Fatal(err)
+		}
+		PageID, EntryIndex, err := db.placeRecord(&Record{Fields: []string{"half", "x"}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := db.Log.Store.(*BufferPool).Flush(); err != nil {
+			t.Fatal(err)
+		}
+		crash(db)
+
+		db = openTest(t, Path)
+		if len(db.Recovery.RolledBack) != 1 || db.Recovery.Undone == 0 {
+			t.Fatalf("%v: unfinished transaction was not rolled back: %+v", Format, *db.Recovery)
+		}
+		if Page, err := db.Store.ReadPage(PageID); err == nil {
+			if _, err := Page.GetRecord(EntryIndex); err == nil {
+				t.Fatalf("%v: half-written record survived recovery", Format)
+			}
+		}
+		if Count := countKeys(t, db.Index); Count != 200 {
+			t.Fatalf("%v: index holds %d keys, want 200", Format, Count)
+		}
+		if err := db.Close(); err != nil {
+			t.Fatal(err)
+		}
+
+		// A clean shutdown leaves nothing to roll back.
+		db = openTest(t, Path)
+		if len(db.Recovery.RolledBack) != 0 {
+			t.Fatalf("%v: second recovery rolled back %v", Format, db.Recovery.RolledBack)
+		}
+		db.Close()
+	}
+}
+
+func TestRecoveryAfterSavepointRollback(t *testing.T) {
+	for _, Format := range fileFormats {
+		for _, Frames := range []int{0, 64} {
+			var Path string = testPath(t)
+			var Opts []Option = []Option{WithFormat(Format)}
+			if Frames > 0 {
+				Opts = append(Opts, WithBufferPool(Frames))
+			}
+			db := openTest(t, Path, Opts...)
+			if err := db.Insert("before", "v"); err != nil {
+				t.Fatal(err)
+			}
+			tx, err := db.Begin()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := tx.Insert("ok", "v"); err != nil {
+				t.Fatal(err)
+			}
+			if err := tx.Insert(strings.Repeat("k", 700), strings.Repeat("v", 9000)); err == nil {
+				t.Fatalf("%v/%d: Insert accepted an oversized ID", Format, Frames)
+			}
+			// A statement that spills a record and then fails is rolled back to its
+			// savepoint, which frees the overflow pages it allocated.
+			err = tx.change(func() error {
+				if _, _, err := db.placeRecord(&Record{Fields: []string{"big", strings.Repeat("v", 9000)}}); err != nil {
+					return err
+				}
+				return errors.New("statement failed")
+			})
+			if err == nil {
+				t.Fatalf("%v/%d: failed statement reported no error", Format, Frames)
+			}
+			if Pool, IsPool := db.Log.Store.(*BufferPool); IsPool {
+				if err := Pool.Flush(); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if err := db.Log.WAL.FlushAll(); err != nil {
+				t.Fatal(err)
+			}
+			crash(db)
+
+			// Undoing the transaction must not free those pages a second time.
+			db, err = OpenDatabase(Path)
+			if err != nil {
+				t.Fatalf("%v/%d: recovery failed: %v", Format, Frames, err)
+			}
+			if Record, _ := db.Get("ok"); Record != nil {
+				t.Fatalf("%v/%d: uncommitted record survived recovery", Format, Frames)
+			}
+			if Record, _ := db.Get("before"); Record == nil {
+				t.Fatalf("%v/%d: committed record lost", Format, Frames)
+			}
+			if err := db.Insert("after", strings.Repeat("v", 9000)); err != nil {
+				t.Fatalf("%v/%d: Insert after recovery: %v", Format, Frames, err)
+			}
+			db.Close()
+		}
+	}
+}
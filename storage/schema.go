@@ -0,0 +1,214 @@
+package storage
+
+import (
+	"fmt"
+	"slices"
+	"strconv"
+	"time"
+)
+
+// ColumnType is the type of the values a table column holds.
+type ColumnType int
+
+const (
+	// Int64Type columns hold int64 values.
+	Int64Type ColumnType = iota + 1
+	// Float64Type columns hold float64 values.
+	Float64Type
+	// StringType columns hold string values.
+	StringType
+	// BoolType columns hold bool values.
+	BoolType
+	// BytesType columns hold []byte values.
+	BytesType
+	// TimestampType columns hold time.Time values, stored in UTC with nanosecond precision.
+	TimestampType
+)
+
+// columnTypeNames are the names the catalog records column types under.
+var columnTypeNames = map[ColumnType]string{
+	Int64Type:     "int64",
+	Float64Type:   "float64",
+	StringType:    "string",
+	BoolType:      "bool",
+	BytesType:     "bytes",
+	TimestampType: "timestamp",
+}
+
+// String returns the name of the column type.
+func (self ColumnType) String() string {
+	if Name, Known := columnTypeNames[self]; Known {
+		return Name
+	}
+	return fmt.Sprintf("ColumnType(%d)", int(self))
+}
+
+// parseColumnType returns the column type with the given name.
+func parseColumnType(Name string) (ColumnType, error) {
+	for Type, TypeName := range columnTypeNames {
+		if TypeName == Name {
+			return Type, nil
+		}
+	}
+	return 0, fmt.Errorf("unknown column type '%s'", Name)
+}
+
+// Column is a named, typed column of a table.
+type Column struct {
+	Name string
+	Type ColumnType
+}
+
+// Schema describes the columns of a table. Every row has a value for every column.
+type Schema struct {
+	Columns    []Column
+	PrimaryKey string // Name of the column the table is keyed on; the first column if empty
+}
+
+// Row holds one value per column, keyed by column name. Values have the Go type of
+// their column: int64, float64, string, bool, []byte or time.Time.
+type Row map[string]any
+
+// validate checks that the schema has uniquely named columns of known types and
+// fills in the default primary key.
+func (self *Schema) validate() error {
+	if len(self.Columns) == 0 {
+		return fmt.Errorf("a table needs at least one column")
+	}
+	var Names []string
+	for _, Column := range self.Columns {
+		if Column.Name == "" {
+			return fmt.Errorf("column names cannot be empty")
+		}
+		if slices.Contains(Names, Column.Name) {
+			return fmt.Errorf("duplicate column '%s'", Column.Name)
+		}
+		if _, Known := columnTypeNames[Column.Type]; !Known {
+			return fmt.Errorf("column '%s' has unknown type %d", Column.Name, int(Column.Type))
+		}
+		Names = append(Names, Column.Name)
+	}
+	if self.PrimaryKey == "" {
+		self.PrimaryKey = self.Columns[0].Name
+	}
+	if !slices.Contains(Names, self.PrimaryKey) {
+		return fmt.Errorf("primary key '%s' is not a column", self.PrimaryKey)
+	}
+	return nil
+}
+
+// column returns the index of the named column, or -1 if there is none.
+func (self *Schema) column(Name string) int {
+	return slices.IndexFunc(self.Columns, func(Column Column) bool {
+		return Column.Name == Name
+	})
+}
+
+// keyColumn returns the index of the primary-key column.
+func (self *Schema) keyColumn() int {
+	return self.column(self.PrimaryKey)
+}
+
+// encodeRow checks a row against the schema and encodes its values as record
+// fields, in column order.
+func (self *Schema) encodeRow(Row Row) ([]string, error) {
+	for Name := range Row {
+		if self.column(Name) == -1 {
+			return nil, fmt.Errorf("unknown column '%s'", Name)
+		}
+	}
+	var Fields []string = make([]string, len(self.Columns))
+	for i, Column := range self.Columns {
+		Value, Present := Row[Column.Name]
+		if !Present {
+			return nil, fmt.Errorf("missing value for column '%s'", Column.Name)
+		}
+		Field, err := encodeValue(Column, Value)
+		if err != nil {
+			return nil, err
+		}
+		Fields[i] = Field
+	}
+	return Fields, nil
+}
+
+// decodeRow turns the fields of a record written by encodeRow back into a row.
+func (self *Schema) decodeRow(Fields []string) (Row, error) {
+	if len(Fields) != len(self.Columns) {
+		return nil, fmt.Errorf("record has %d fields, table has %d columns", len(Fields), len(self.Columns))
+	}
+	var Row Row = make(Row, len(Fields))
+	for i, Column := range self.Columns {
+		Value, err := decodeValue(Column, Fields[i])
+		if err != nil {
+			return nil, err
+		}
+		Row[Column.Name] = Value
+	}
+	return Row, nil
+}
+
+// encodeValue encodes a value of the column's type as a record field.
+func encodeValue(Column Column, Value any) (string, error) {
+	var Field string
+	var Matches bool
+	switch Column.Type {
+	case Int64Type:
+		var Int int64
+		if Int, Matches = Value.(int64); Matches {
+			Field = strconv.FormatInt(Int, 10)
+		}
+	case Float64Type:
+		var Float float64
+		if Float, Matches = Value.(float64); Matches {
+			Field = strconv.FormatFloat(Float, 'g', -1, 64)
+		}
+	case StringType:
+		Field, Matches = Value.(string)
+	case BoolType:
+		var Bool bool
+		if Bool, Matches = Value.(bool); Matches {
+			Field = strconv.FormatBool(Bool)
+		}
+	case BytesType:
+		var Bytes []byte
+		if Bytes, Matches = Value.([]byte); Matches {
+			Field = string(Bytes)
+		}
+	case TimestampType:
+		var Time time.Time
+		if Time, Matches = Value.(time.Time); Matches {
+			Field = Time.UTC().Format(time.RFC3339Nano)
+		}
+	}
+	if !Matches {
+		return "", fmt.Errorf("column '%s' holds %s values, got %T", Column.Name, Column.Type, Value)
+	}
+	return Field, nil
+}
+
+// decodeValue decodes a record field written by encodeValue.
+func decodeValue(Column Column, Field string) (any, error) {
+	var Value any
+	var err error
+	switch Column.Type {
+	case Int64Type:
+		Value, err = strconv.ParseInt(Field, 10, 64)
+	case Float64Type:
+		Value, err = strconv.ParseFloat(Field, 64)
+	case StringType:
+		Value = Field
+	case BoolType:
+		Value, err = strconv.ParseBool(Field)
+	case BytesType:
+		Value = []byte(Field)
+	case TimestampType:
+		Value, err = time.Parse(time.RFC3339Nano, Field)
+	default:
+		err = fmt.Errorf("unknown type %d", int(Column.Type))
+	}
+	if err != nil {
+		return nil, fmt.Errorf("corrupt value '%s' in column '%s': %w", Field, Column.Name, err)
+	}
+	return Value, nil
+}
@@ -0,0 +1,229 @@
+package storage
+
+import (
+	"errors"
+	"fmt"
+)
+
+// SecondaryIndex is a B+ tree over one column of a table. Like the primary-key
+// index, it points at the rows' data page slots. Its keys are the keyenc tuple of
+// the column value and, unless the index is unique, the row's primary key, so that
+// rows sharing a value still have distinct keys and sort by primary key among
+// themselves.
+type SecondaryIndex struct {
+	Column string
+	Unique bool
+	Tree   *BPlusTree
+}
+
+// CreateIndex builds a secondary index over a column of an existing table and keeps
+// it up to date as rows are inserted, updated and deleted. A unique index fails to
+// build if two rows already share a value, and afterwards rejects changes that
+// would make them.
+func (db *Database) CreateIndex(TableName string, Column string, Unique bool) error {
+	db.Mutex.Lock()
+	defer db.Mutex.Unlock()
+	return db.logged(func() error {
+		return db.createIndex(TableName, Column, Unique)
+	})
+}
+
+// createIndex builds a secondary index. The caller holds the write lock.
+func (db *Database) createIndex(TableName string, Column string, Unique bool) error {
+	// 1. Find the table and column
+	Table, err := db.Table(TableName)
+	if err != nil {
+		return err
+	}
+	if Table.Schema.column(Column) == -1 {
+		return fmt.Errorf("table '%s' has no column '%s'", TableName, Column)
+	}
+	if Table.index(Column) != nil {
+		return fmt.Errorf("column '%s' of table '%s' is already indexed", Column, TableName)
+	}
+
+	// 2. Create the index's tree
+	Tree, err := createTree(db.Store, db.Index.Order)
+	if err != nil {
+		return err
+	}
+	var Index *SecondaryIndex = &SecondaryIndex{Column: Column, Unique: Unique, Tree: Tree}
+
+	// 3. Add every existing row to it
+	var Cursor *Cursor = Table.Index.Cursor()
+	for ok := Cursor.First(); ok; ok = Cursor.Next() {
+		PageID, EntryIndex, err := Cursor.Value()
+		if err != nil {
+			return err
+		}
+		DataPage, err := db.Store.ReadPage(PageID)
+		if err != nil {
+			return err
+		}
+		Record, err := db.readRecord(DataPage, EntryIndex)
+		if err != nil {
+			return err
+		}
+		if err := Table.addToIndex(Index, Record.Fields, PageID, EntryIndex); err != nil {
+			return err
+		}
+	}
+	if err := Cursor.Err(); err != nil {
+		return err
+	}
+
+	// 4. Record the index in the catalog
+	return db.Catalog.addIndex(Table, Index)
+}
+
+// Lookup returns the rows whose column equals Value, using the column's secondary
+// index. Like Get, it reads from a snapshot of the latest commit.
+func (table *Table) Lookup(Column string, Value any) ([]Row, error) {
+	Snapshot, err := table.db.BeginRead()
+	if err != nil {
+		return nil, err
+	}
+	defer Snapshot.Close()
+	return Snapshot.Lookup(table, Column, Value)
+}
+
+// LookupRange returns the rows whose column lies in [Start, End), in index order,
+// using the column's secondary index. A nil Start or End leaves that end of the
+// range open. Like Get, it reads from a snapshot of the latest commit.
+func (table *Table) LookupRange(Column string, Start any, End any) ([]Row, error) {
+	Snapshot, err := table.db.BeginRead()
+	if err != nil {
+		return nil, err
+	}
+	defer Snapshot.Close()
+	return Snapshot.LookupRange(table, Column, Start, End)
+}
+
+// Lookup returns the rows of a table whose column equals Value as of the snapshot.
+func (tx *ReadTx) Lookup(Table *Table, Column string, Value any) ([]Row, error) {
+	Prefix, err := Table.columnKey(Column, Value)
+	if err != nil {
+		return nil, err
+	}
+	return tx.lookup(Table, Column, Prefix, PrefixEnd(Prefix))
+}
+
+// LookupRange returns the rows of a table whose column lies in [Start, End) as of
+// the snapshot. A nil Start or End leaves that end of the range open.
+func (tx *ReadTx) LookupRange(Table *Table, Column string, Start any, End any) ([]Row, error) {
+	var StartKey, EndKey string
+	var err error
+	if Start != nil {
+		if StartKey, err = Table.columnKey(Column, Start); err != nil {
+			return nil, err
+		}
+	}
+	if End != nil {
+		if EndKey, err = Table.columnKey(Column, End); err != nil {
+			return nil, err
+		}
+	}
+	return tx.lookup(Table, Column, StartKey, EndKey)
+}
+
+// lookup returns the rows whose keys in the column's secondary index fall in
+// [StartKey, EndKey). An empty EndKey scans to the end of the index. Keyenc keys of
+// a longer tuple sort right after their prefix, so the keys of a non-unique index
+// fall in the same ranges as their column values.
+func (tx *ReadTx) lookup(Table *Table, Column string, StartKey string, EndKey string) ([]Row, error) {
+	if tx.done {
+		return nil, ErrTxDone
+	}
+	var Index *SecondaryIndex = Table.index(Column)
+	if Index == nil {
+		return nil, fmt.Errorf("column '%s' of table '%s' is not indexed", Column, Table.Name)
+	}
+	Tree, err := openTree(tx.view.Store, Index.Tree.MetaPageID)
+	if err != nil {
+		return nil, err
+	}
+
+	var Rows []Row
+	var Cursor *Cursor = Tree.Cursor()
+	for ok := Cursor.Seek(StartKey); ok; ok = Cursor.Next() {
+		if EndKey != "" && Cursor.Key() >= EndKey {
+			break
+		}
+		PageID, EntryIndex, err := Cursor.Value()
+		if err != nil {
+			return nil, err
+		}
+		DataPage, err := tx.view.Store.ReadPage(PageID)
+		if err != nil {
+			return nil, err
+		}
+		Record, err := tx.view.readRecord(DataPage, EntryIndex)
+		if err != nil {
+			return nil, err
+		}
+		Row, err := Table.Schema.decodeRow(Record.Fields)
+		if err != nil {
+			return nil, err
+		}
+		Rows = append(Rows, Row)
+	}
+	return Rows, Cursor.Err()
+}
+
+// index returns the secondary index over a column, or nil if it is not indexed.
+func (table *Table) index(Column string) *SecondaryIndex {
+	table.db.Catalog.Mutex.RLock()
+	defer table.db.Catalog.Mutex.RUnlock()
+	return table.Indexes[Column]
+}
+
+// indexKey returns the key of an encoded row in a secondary index.
+func (table *Table) indexKey(Index *SecondaryIndex, Fields []string) (string, error) {
+	if Index.Unique {
+		return table.keyOf(Fields, table.Schema.column(Index.Column))
+	}
+	return table.keyOf(Fields, table.Schema.column(Index.Column), table.Schema.keyColumn())
+}
+
+// addToIndex adds the row stored at PageID and EntryIndex to a secondary index. It
+// fails if the index is unique and another row already has the same value.
+func (table *Table) addToIndex(Index *SecondaryIndex, Fields []string, PageID uint, EntryIndex uint) error {
+	Key, err := table.indexKey(Index, Fields)
+	if err != nil {
+		return err
+	}
+	if Index.Unique {
+		if _, _, err := Index.Tree.Find(Key); err == nil {
+			return fmt.Errorf("duplicate value '%s' for unique index on '%s' of table '%s'", Fields[table.Schema.column(Index.Column)], Index.Column, table.Name)
+		} else if !errors.Is(err, ErrKeyNotFound) {
+			return err
+		}
+	}
+	return Index.Tree.Insert(Key, PageID, EntryIndex)
+}
+
+// indexRow adds the row stored at PageID and EntryIndex to every secondary index of
+// the table. The caller holds the write lock.
+func (table *Table) indexRow(Fields []string, PageID uint, EntryIndex uint) error {
+	for _, Index := range table.Indexes {
+		if err := table.addToIndex(Index, Fields, PageID, EntryIndex); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// unindexRow removes a row from every secondary index of the table. The caller holds
+// the write lock.
+func (table *Table) unindexRow(Fields []string) error {
+	for _, Index := range table.Indexes {
+		Key, err := table.indexKey(Index, Fields)
+		if err != nil {
+			return err
+		}
+		if err := Index.Tree.Delete(Key); err != nil {
+			return err
+		}
+	}
+	return nil
+}
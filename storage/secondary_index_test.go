@@ -0,0 +1,138 @@
+package storage
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSecondaryIndexes(t *testing.T) {
+	for _, Format := range fileFormats {
+		var Path string = testPath(t)
+		db := openTest(t, Path, WithFormat(Format), WithBTreeOrder(4))
+		Users, err := db.CreateTable("users", Schema{Columns: []Column{{"id", StringType}, {"email", StringType}, {"city", StringType}}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		for i := 0; i < 40; i++ {
+			if err := Users.Insert(Row{"id": fmt.Sprintf("u%02d", i), "email": fmt.Sprintf("e%02d@x", i), "city": fmt.Sprintf("c%d", i%4)}); err != nil {
+				t.Fatal(err)
+			}
+		}
+		// Indexes created on a populated table are backfilled.
+		if err := db.CreateIndex("users", "email", true); err != nil {
+			t.Fatal(err)
+		}
+		if err := db.CreateIndex("users", "city", false); err != nil {
+			t.Fatal(err)
+		}
+		if err := db.CreateIndex("users", "city", true); err == nil {
+			t.Fatalf("%v: CreateIndex accepted a second index on city", Format)
+		}
+		if err := db.CreateIndex("users", "id", false); err != nil {
+			t.Fatal(err)
+		}
+		if err := Users.Insert(Row{"id": "u99", "email": "e03@x", "city": "c9"}); err == nil {
+			t.Fatalf("%v: Insert violated the unique email index", Format)
+		}
+		if Row, _ := Users.Get("u99"); Row != nil {
+			t.Fatalf("%v: row of a rejected insert survived", Format)
+		}
+		if err := Users.Update(Row{"id": "u05", "email": "new@x", "city": strings.Repeat("z", 3000)}); err == nil {
+			t.Fatalf("%v: Update indexed a city too large for an order-4 node", Format)
+		}
+		if Row, _ := Users.Get("u05"); Row == nil || Row["email"] != "e05@x" {
+			t.Fatalf("%v: rejected Update changed the row: %v", Format, Row)
+		}
+		if err := Users.Update(Row{"id": "u05", "email": "new@x", "city": strings.Repeat("z", 300)}); err != nil {
+			t.Fatal(err)
+		}
+		if err := Users.Update(Row{"id": "u06", "email": "e07@x", "city": "c0"}); err == nil {
+			t.Fatalf("%v: Update violated the unique email index", Format)
+		}
+		if err := Users.Delete("u08"); err != nil {
+			t.Fatal(err)
+		}
+		if err := db.Close(); err != nil {
+			t.Fatal(err)
+		}
+
+		db = openTest(t, Path)
+		if Users, err = db.Table("users"); err != nil {
+			t.Fatal(err)
+		}
+		Rows, err := Users.Lookup("email", "new@x")
+		if err != nil || len(Rows) != 1 || Rows[0]["id"] != "u05" {
+			t.Fatalf("%v: Lookup of an updated email = %v, %v", Format, Rows, err)
+		}
+		if Rows, _ := Users.Lookup("email", "e05@x"); len(Rows) != 0 {
+			t.Fatalf("%v: Lookup of a replaced email = %v", Format, Rows)
+		}
+		if Rows, _ := Users.Lookup("email", "e06@x"); len(Rows) != 1 {
+			t.Fatalf("%v: failed Update changed the email index: %v", Format, Rows)
+		}
+		Rows, err = Users.Lookup("city", "c0")
+		if err != nil || len(Rows) != 9 {
+			t.Fatalf("%v: Lookup of city c0 returned %d rows, %v", Format, len(Rows), err)
+		}
+		for i := 1; i < len(Rows); i++ {
+			if Rows[i-1]["id"].(string) >= Rows[i]["id"].(string) {
+				t.Fatalf("%v: rows with equal index values are not in primary-key order", Format)
+			}
+		}
+		Rows, err = Users.LookupRange("email", "e10@x", "e20@x")
+		if err != nil || len(Rows) != 10 {
+			t.Fatalf("%v: LookupRange of email returned %d rows, %v", Format, len(Rows), err)
+		}
+		Rows, err = Users.LookupRange("id", nil, "u10")
+		if err != nil || len(Rows) != 9 {
+			t.Fatalf("%v: open-ended LookupRange returned %d rows, %v", Format, len(Rows), err)
+		}
+		if _, err := Users.Lookup("missing", "x"); err == nil {
+			t.Fatalf("%v: Lookup on an unknown column succeeded", Format)
+		}
+		db.Close()
+	}
+}
+
+func TestSecondaryIndexRangesSortByValue(t *testing.T) {
+	db, err := OpenInMemory(WithBTreeOrder(4))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	People, err := db.CreateTable("people", Schema{Columns: []Column{{"id", Int64Type}, {"age", Int64Type}, {"born", TimestampType}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var Base time.Time = time.Date(2000, 1, 1, 0, 0, 0, 0, time.UTC)
+	for i := int64(-20); i < 20; i++ {
+		if err := People.Insert(Row{"id": i, "age": i % 7, "born": Base.Add(time.Duration(i) * time.Hour)}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := db.CreateIndex("people", "age", false); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.CreateIndex("people", "born", true); err != nil {
+		t.Fatal(err)
+	}
+
+	Rows, err := People.LookupRange("age", int64(-3), int64(3))
+	if err != nil || len(Rows) == 0 {
+		t.Fatalf("LookupRange of age returned %d rows, %v", len(Rows), err)
+	}
+	var Last int64 = -100
+	for _, Row := range Rows {
+		var Age int64 = Row["age"].(int64)
+		if Age < -3 || Age >= 3 || Age < Last {
+			t.Fatalf("age %d out of range or order after %d", Age, Last)
+		}
+		Last = Age
+	}
+	Rows, err = People.LookupRange("born", Base.Add(-2*time.Hour), Base.Add(10*time.Hour))
+	if err != nil || len(Rows) != 12 || Rows[0]["id"] != int64(-2) {
+		t.Fatalf("LookupRange of born returned %d rows starting with %v, %v", len(Rows), Rows[0]["id"], err)
+	}
+}
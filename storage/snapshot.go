@@ -0,0 +1,114 @@
+package storage
+
+import (
+	"errors"
+	"fmt"
+)
+
+// ErrReadOnly is returned when something tries to change a snapshot.
+var ErrReadOnly = errors.New("snapshot is read-only")
+
+// ReadTx is a read-only transaction pinned to the LSN of the latest commit when it
+// began. It sees the database exactly as it was at that commit, however long it
+// stays open and whatever writers commit in the meantime, and it never blocks
+// them. Close releases the old page versions it was keeping alive.
+type ReadTx struct {
+	LSN  uint64
+	view *Database // Index and Store as of LSN, and the live Catalog
+	done bool
+}
+
+// snapshotStore is the read-only PageStore a ReadTx reads pages through.
+type snapshotStore struct {
+	Log *LoggedStore
+	LSN uint64
+}
+
+// BeginRead starts a read-only transaction on the latest committed state.
+func (db *Database) BeginRead() (*ReadTx, error) {
+	var Log *LoggedStore = db.Log
+	var LSN uint64 = Log.Versions.Pin()
+	var Store *snapshotStore = &snapshotStore{Log: Log, LSN: LSN}
+
+	Index, err := openTree(Store, db.Index.MetaPageID)
+	if err != nil {
+		Log.Versions.Unpin(LSN)
+		return nil, err
+	}
+
+	var ReadTx *ReadTx = &ReadTx{
+		LSN:  LSN,
+		view: &Database{Store: Store, Log: Log, Index: Index, Catalog: db.Catalog},
+	}
+	return ReadTx, nil
+}
+
+// Get retrieves a record by its ID as of the snapshot.
+func (tx *ReadTx) Get(ID string) (*Record, error) {
+	if tx.done {
+		return nil, ErrTxDone
+	}
+	return tx.view.get(ID)
+}
+
+// Scan returns the records whose IDs fall in [startKey, endKey) as of the snapshot.
+func (tx *ReadTx) Scan(startKey string, endKey string) ([]*Record, error) {
+	if tx.done {
+		return nil, ErrTxDone
+	}
+	return tx.view.scan(startKey, endKey)
+}
+
+// Close ends the read transaction.
+func (tx *ReadTx) Close() {
+	if !tx.done {
+		tx.done = true
+		tx.view.Log.Versions.Unpin(tx.LSN)
+	}
+}
+
+// ReadPage returns the page as it was at the snapshot's LSN.
+func (self *snapshotStore) ReadPage(PageID uint) (*Page, error) {
+	return self.Log.Versions.ReadPage(self.Log.Store, PageID, self.LSN)
+}
+
+// readAllocated returns the page as it was at the snapshot's LSN, or
+// ErrPageNotFound if it was not allocated then.
+func (self *snapshotStore) readAllocated(PageID uint) (*Page, error) {
+	return self.Log.Versions.readAllocated(self.Log.Store, PageID, self.LSN)
+}
+
+// WritePage always fails with ErrReadOnly.
+func (self *snapshotStore) WritePage(Page *Page) error {
+	return fmt.Errorf("%w: cannot write page %d", ErrReadOnly, Page.Header.PageID)
+}
+
+// AllocatePage always fails with ErrReadOnly.
+func (self *snapshotStore) AllocatePage() (*Page, error) {
+	return nil, ErrReadOnly
+}
+
+// FreePage always fails with ErrReadOnly.
+func (self *snapshotStore) FreePage(PageID uint) error {
+	return fmt.Errorf("%w: cannot free page %d", ErrReadOnly, PageID)
+}
+
+// PageSize returns the size of a page in bytes.
+func (self *snapshotStore) PageSize() int {
+	return self.Log.PageSize()
+}
+
+// PageCount returns the highest PageID allocated so far.
+func (self *snapshotStore) PageCount() uint {
+	return self.Log.PageCount()
+}
+
+// Sync does nothing; a snapshot has nothing to write.
+func (self *snapshotStore) Sync() error {
+	return nil
+}
+
+// Close does nothing; the snapshot's pages belong to the database.
+func (self *snapshotStore) Close() error {
+	return nil
+}
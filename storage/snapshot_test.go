@@ -0,0 +1,115 @@
+package storage
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestReadTxSeesItsSnapshot(t *testing.T) {
+	for _, Path := range []string{MemoryFilePath, testPath(t)} {
+		db := openTest(t, Path, WithBTreeOrder(4), WithBufferPool(16))
+		insertKeys(t, db, "k", 200, "v0")
+		Snapshot, err := db.BeginRead()
+		if err != nil {
+			t.Fatal(err)
+		}
+		for i := 0; i < 150; i++ {
+			if err := db.Delete(fmt.Sprintf("k%03d", i)); err != nil {
+				t.Fatal(err)
+			}
+		}
+		for i := 150; i < 200; i++ {
+			if err := db.Update(fmt.Sprintf("k%03d", i), strings.Repeat("w", 100)); err != nil {
+				t.Fatal(err)
+			}
+		}
+		for i := 200; i < 400; i++ {
+			if err := db.Insert(fmt.Sprintf("k%03d", i), "new"); err != nil {
+				t.Fatal(err)
+			}
+		}
+		tx, err := db.Begin()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := tx.Insert("uncommitted", "x"); err != nil {
+			t.Fatal(err)
+		}
+
+		Records, err := Snapshot.Scan("", "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(Records) != 200 {
+			t.Fatalf("%s: snapshot sees %d records, want 200", Path, len(Records))
+		}
+		for i, Record := range Records {
+			if Record.Fields[0] != fmt.Sprintf("k%03d", i) || Record.Fields[1] != "v0" {
+				t.Fatalf("%s: snapshot record %d is %q", Path, i, Record.Fields)
+			}
+		}
+		if Record, _ := db.Get("uncommitted"); Record != nil {
+			t.Fatalf("%s: Get sees an uncommitted insert", Path)
+		}
+		if err := tx.Rollback(); err != nil {
+			t.Fatal(err)
+		}
+		Snapshot.Close()
+		if Count := len(db.Log.Versions.versions); Count != 0 {
+			t.Fatalf("%s: %d page versions kept after the last snapshot closed", Path, Count)
+		}
+		if All, _ := db.Scan("", ""); len(All) != 250 {
+			t.Fatalf("%s: Scan returned %d records, want 250", Path, len(All))
+		}
+		db.Close()
+	}
+}
+
+func TestReadTxNeverSeesHalfATransaction(t *testing.T) {
+	db := openTest(t, testPath(t), WithBTreeOrder(4), WithBufferPool(16))
+	defer db.Close()
+	var Readers sync.WaitGroup
+	var Stop chan struct{} = make(chan struct{})
+	for r := 0; r < 4; r++ {
+		Readers.Add(1)
+		go func() {
+			defer Readers.Done()
+			for {
+				select {
+				case <-Stop:
+					return
+				default:
+				}
+				Records, err := db.Scan("", "")
+				if err != nil {
+					t.Error(err)
+					return
+				}
+				// Every transaction inserts a pair of records.
+				if len(Records)%2 != 0 {
+					t.Errorf("Scan saw %d records, half a transaction", len(Records))
+					return
+				}
+			}
+		}()
+	}
+	for i := 0; i < 100; i++ {
+		tx, err := db.Begin()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := tx.Insert(fmt.Sprintf("a%03d", i), "1"); err != nil {
+			t.Fatal(err)
+		}
+		if err := tx.Insert(fmt.Sprintf("b%03d", i), "1"); err != nil {
+			t.Fatal(err)
+		}
+		if err := tx.Commit(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	close(Stop)
+	Readers.Wait()
+}
@@ -0,0 +1,50 @@
+package storage
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+)
+
+// SyncMode controls when the database forces its writes to stable storage.
+type SyncMode int
+
+const (
+	// SyncNormal syncs the write-ahead log before a commit returns and the database
+	// file at checkpoints and on close. A committed transaction survives power loss,
+	// because recovery can replay it from the log.
+	SyncNormal SyncMode = iota
+	// SyncFull also syncs the database file every time a page is written to it, so
+	// that the file itself is never behind what has been written back.
+	SyncFull
+	// SyncOff never syncs. Committed transactions survive the process crashing but
+	// can be lost if the machine does.
+	SyncOff
+)
+
+// syncFile syncs File unless Mode is SyncOff.
+func syncFile(File *os.File, Mode SyncMode) error {
+	if Mode == SyncOff {
+		return nil
+	}
+	return File.Sync()
+}
+
+// syncDirectory syncs the directory holding FilePath, so that a newly created file
+// is still there after a power loss. Windows cannot sync directories and does not
+// need to.
+func syncDirectory(FilePath string) error {
+	if runtime.GOOS == "windows" {
+		return nil
+	}
+	Directory, Error := os.Open(filepath.Dir(FilePath))
+	if Error != nil {
+		return fmt.Errorf("Failed to open directory of %s: %w", FilePath, Error)
+	}
+	defer Directory.Close()
+	if Error = Directory.Sync(); Error != nil {
+		return fmt.Errorf("Failed to sync directory of %s: %w", FilePath, Error)
+	}
+	return nil
+}
@@ -0,0 +1,26 @@
+package storage
+
+import "testing"
+
+func TestSyncModes(t *testing.T) {
+	for _, Mode := range []SyncMode{SyncNormal, SyncFull, SyncOff} {
+		for _, Format := range fileFormats {
+			var Path string = testPath(t)
+			db := openTest(t, Path, WithSyncMode(Mode), WithFormat(Format))
+			if err := db.Insert("k", "v"); err != nil {
+				t.Fatalf("%v/%v: Insert: %v", Mode, Format, err)
+			}
+			if err := db.Close(); err != nil {
+				t.Fatalf("%v/%v: Close: %v", Mode, Format, err)
+			}
+			db = openTest(t, Path, WithSyncMode(Mode))
+			if Record, err := db.Get("k"); err != nil || Record == nil {
+				t.Fatalf("%v/%v: Get after reopening = %v, %v", Mode, Format, Record, err)
+			}
+			db.Close()
+		}
+	}
+	if _, err := OpenDatabase(MemoryFilePath, WithSyncMode(7)); err == nil {
+		t.Fatal("OpenDatabase accepted an unknown sync mode")
+	}
+}
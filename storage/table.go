@@ -0,0 +1,325 @@
+package storage
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+
+	"twoDB/keyenc"
+)
+
+// Table is a named set of rows with a fixed schema. The tables of a database share
+// its file, data pages and free-space map; each has its own B+ tree over the
+// primary key, pointing at rows the way the main index points at records. Index
+// keys are encoded with keyenc, so that numeric and timestamp keys sort by value.
+// A row is stored as a record with one field per column, in column order.
+type Table struct {
+	Name    string
+	Schema  Schema
+	Index   *BPlusTree                 // Primary-key index
+	Indexes map[string]*SecondaryIndex // Secondary indexes by column, guarded by the catalog's Mutex
+	db      *Database
+}
+
+// CreateTable adds a table with the given schema to the database.
+func (db *Database) CreateTable(Name string, Schema Schema) (*Table, error) {
+	if Name == "" {
+		return nil, fmt.Errorf("table names cannot be empty")
+	}
+	Schema.Columns = slices.Clone(Schema.Columns)
+	if err := Schema.validate(); err != nil {
+		return nil, err
+	}
+
+	db.Mutex.Lock()
+	defer db.Mutex.Unlock()
+	var Table *Table
+	err := db.logged(func() error {
+		var err error
+		Table, err = db.createTable(Name, Schema)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return Table, nil
+}
+
+// createTable adds a table to the catalog. The caller holds the write lock.
+func (db *Database) createTable(Name string, Schema Schema) (*Table, error) {
+	// 1. Check that the name is free
+	if db.Catalog.table(Name) != nil {
+		return nil, fmt.Errorf("table '%s' already exists", Name)
+	}
+
+	// 2. Create the table's primary-key index
+	Index, err := createTree(db.Store, db.Index.Order)
+	if err != nil {
+		return nil, err
+	}
+
+	// 3. Record the table in the catalog
+	var Table *Table = &Table{
+		Name:    Name,
+		Schema:  Schema,
+		Index:   Index,
+		Indexes: make(map[string]*SecondaryIndex),
+		db:      db,
+	}
+	if err := db.Catalog.add(Table); err != nil {
+		return nil, err
+	}
+	return Table, nil
+}
+
+// Table returns the named table.
+func (db *Database) Table(Name string) (*Table, error) {
+	if Table := db.Catalog.table(Name); Table != nil {
+		return Table, nil
+	}
+	return nil, fmt.Errorf("table '%s' does not exist", Name)
+}
+
+// Insert validates a row against the schema and adds it to the table.
+func (table *Table) Insert(Row Row) error {
+	Fields, err := table.Schema.encodeRow(Row)
+	if err != nil {
+		return err
+	}
+	table.db.Mutex.Lock()
+	defer table.db.Mutex.Unlock()
+	return table.db.logged(func() error {
+		return table.insert(Fields)
+	})
+}
+
+// insert adds an encoded row to the table. The caller holds the write lock.
+func (table *Table) insert(Fields []string) error {
+	Key, err := table.keyOf(Fields, table.Schema.keyColumn())
+	if err != nil {
+		return err
+	}
+
+	// 1. Check that the keys can be indexed and the row does not exist yet, before
+	// any page is written
+	if err := table.checkKeys(Key, Fields); err != nil {
+		return err
+	}
+	if _, _, err := table.Index.Find(Key); err == nil {
+		return fmt.Errorf("row with key %s already exists in table '%s'", keyenc.String(Key), table.Name)
+	} else if !errors.Is(err, ErrKeyNotFound) {
+		return err
+	}
+
+	// 2. Write the row to a data page with room for it
+	PageID, EntryIndex, err := table.db.placeRecord(&Record{Fields: Fields})
+	if err != nil {
+		return err
+	}
+
+	// 3. Insert the key into the table's index
+	if err := table.Index.Insert(Key, PageID, EntryIndex); err != nil {
+		return err
+	}
+
+	// 4. Add the row to the secondary indexes
+	return table.indexRow(Fields, PageID, EntryIndex)
+}
+
+// Get retrieves the row with the given primary key, or nil if there is none. Like
+// Database.Get, it reads from a snapshot of the latest commit.
+func (table *Table) Get(Key any) (Row, error) {
+	Snapshot, err := table.db.BeginRead()
+	if err != nil {
+		return nil, err
+	}
+	defer Snapshot.Close()
+	return Snapshot.GetRow(table, Key)
+}
+
+// GetRow retrieves a row of a table by its primary key as of the snapshot, or nil
+// if there is none.
+func (tx *ReadTx) GetRow(Table *Table, Key any) (Row, error) {
+	if tx.done {
+		return nil, ErrTxDone
+	}
+	IndexKey, err := Table.columnKey(Table.Schema.PrimaryKey, Key)
+	if err != nil {
+		return nil, err
+	}
+	Index, err := openTree(tx.view.Store, Table.Index.MetaPageID)
+	if err != nil {
+		return nil, err
+	}
+	var View *Database = &Database{Store: tx.view.Store, Log: tx.view.Log, Index: Index}
+	Record, err := View.get(IndexKey)
+	if err != nil || Record == nil {
+		return nil, err
+	}
+	return Table.Schema.decodeRow(Record.Fields)
+}
+
+// Update replaces the row that has the same primary key as Row.
+func (table *Table) Update(Row Row) error {
+	Fields, err := table.Schema.encodeRow(Row)
+	if err != nil {
+		return err
+	}
+	table.db.Mutex.Lock()
+	defer table.db.Mutex.Unlock()
+	return table.db.logged(func() error {
+		return table.update(Fields)
+	})
+}
+
+// update replaces a row with an encoded one. The caller holds the write lock.
+func (table *Table) update(Fields []string) error {
+	var db *Database = table.db
+	Key, err := table.keyOf(Fields, table.Schema.keyColumn())
+	if err != nil {
+		return err
+	}
+
+	// 1. Find the row's location
+	PageID, EntryIndex, err := table.Index.Find(Key)
+	if errors.Is(err, ErrKeyNotFound) {
+		return fmt.Errorf("cannot update non-existent row with key %s in table '%s'", keyenc.String(Key), table.Name)
+	}
+	if err != nil {
+		return err
+	}
+
+	// 2. Read the page and take the old row out of the secondary indexes
+	DataPage, err := db.Store.ReadPage(PageID)
+	if err != nil {
+		return err
+	}
+	OldRecord, err := db.readRecord(DataPage, EntryIndex)
+	if err != nil {
+		return err
+	}
+	if err := table.unindexRow(OldRecord.Fields); err != nil {
+		return err
+	}
+
+	// 3. Replace the row in place if it still fits its slot
+	var NewRecord *Record = &Record{Fields: Fields}
+	if DataPage.OverflowPageID(EntryIndex) == 0 && NewRecord.Size() <= db.maxInlineRecordSize() {
+		err = DataPage.UpdateRecord(EntryIndex, NewRecord, db.Store.PageSize())
+		if err == nil {
+			if err := db.writeDataPage(DataPage); err != nil {
+				return err
+			}
+			return table.indexRow(Fields, PageID, EntryIndex)
+		}
+		if !errors.Is(err, ErrPageFull) {
+			return err
+		}
+	}
+
+	// 4. The row outgrew its slot, so store it again and repoint the index
+	NewPageID, NewEntryIndex, err := db.moveRecord(table.Index, Key, PageID, EntryIndex, NewRecord)
+	if err != nil {
+		return err
+	}
+
+	// 5. Add the new row to the secondary indexes
+	return table.indexRow(Fields, NewPageID, NewEntryIndex)
+}
+
+// Delete removes the row with the given primary key.
+func (table *Table) Delete(Key any) error {
+	IndexKey, err := table.columnKey(table.Schema.PrimaryKey, Key)
+	if err != nil {
+		return err
+	}
+	table.db.Mutex.Lock()
+	defer table.db.Mutex.Unlock()
+	return table.db.logged(func() error {
+		return table.delete(IndexKey)
+	})
+}
+
+// delete removes the row with the given index key. The caller holds the write lock.
+func (table *Table) delete(Key string) error {
+	var db *Database = table.db
+
+	// 1. Find the row's location from the index
+	PageID, EntryIndex, err := table.Index.Find(Key)
+	if errors.Is(err, ErrKeyNotFound) {
+		return fmt.Errorf("row with key %s not found in table '%s'", keyenc.String(Key), table.Name)
+	}
+	if err != nil {
+		return err
+	}
+
+	// 2. Read the data page
+	DataPage, err := db.Store.ReadPage(PageID)
+	if err != nil {
+		return err
+	}
+
+	// 3. Take the row out of the secondary indexes
+	OldRecord, err := db.readRecord(DataPage, EntryIndex)
+	if err != nil {
+		return err
+	}
+	if err := table.unindexRow(OldRecord.Fields); err != nil {
+		return err
+	}
+
+	// 4. Delete the row from the page and write it back
+	if err := db.deleteRecord(DataPage, EntryIndex); err != nil {
+		return err
+	}
+	if err := db.writeDataPage(DataPage); err != nil {
+		return err
+	}
+
+	// 5. Delete the key from the table's index
+	return table.Index.Delete(Key)
+}
+
+// checkKeys returns an error if the primary key or a secondary index key of an
+// encoded row cannot be indexed.
+func (table *Table) checkKeys(Key string, Fields []string) error {
+	if err := table.Index.checkKey(Key); err != nil {
+		return err
+	}
+	for _, Index := range table.Indexes {
+		IndexKey, err := table.indexKey(Index, Fields)
+		if err != nil {
+			return err
+		}
+		if err := Index.Tree.checkKey(IndexKey); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// columnKey checks that Value has the type of the named column and encodes it as
+// an index key.
+func (table *Table) columnKey(Column string, Value any) (string, error) {
+	var ColumnIndex int = table.Schema.column(Column)
+	if ColumnIndex == -1 {
+		return "", fmt.Errorf("table '%s' has no column '%s'", table.Name, Column)
+	}
+	if _, err := encodeValue(table.Schema.Columns[ColumnIndex], Value); err != nil {
+		return "", err
+	}
+	return keyenc.Encode(Value)
+}
+
+// keyOf returns the index key made of the given columns of an encoded row.
+func (table *Table) keyOf(Fields []string, Columns ...int) (string, error) {
+	var Values []any = make([]any, len(Columns))
+	for i, ColumnIndex := range Columns {
+		Value, err := decodeValue(table.Schema.Columns[ColumnIndex], Fields[ColumnIndex])
+		if err != nil {
+			return "", err
+		}
+		Values[i] = Value
+	}
+	return keyenc.Encode(Values...)
+}
@@ -0,0 +1,125 @@
+package storage
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"twoDB/keyenc"
+)
+
+func TestTables(t *testing.T) {
+	var Now time.Time = time.Date(2024, 1, 2, 3, 4, 5, 6, time.UTC)
+	for _, Format := range []StorageFormat{TextFormat, BinaryFormat, MemoryFormat} {
+		var Path string = testPath(t)
+		db := openTest(t, Path, WithFormat(Format), WithBTreeOrder(4))
+		Users, err := db.CreateTable("users", Schema{Columns: []Column{
+			{"id", Int64Type}, {"name", StringType}, {"score", Float64Type},
+			{"admin", BoolType}, {"avatar", BytesType}, {"joined", TimestampType},
+		}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		Tags, err := db.CreateTable("tags", Schema{Columns: []Column{{"tag", StringType}, {"count", Int64Type}}, PrimaryKey: "tag"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := db.CreateTable("tags", Schema{Columns: []Column{{"x", StringType}}}); err == nil {
+			t.Fatalf("%v: CreateTable accepted a duplicate name", Format)
+		}
+		for i := int64(0); i < 30; i++ {
+			if err := Users.Insert(Row{"id": i, "name": fmt.Sprintf("user %d|x", i), "score": float64(i) / 3, "admin": i%2 == 0, "avatar": []byte{0, byte(i), '\n'}, "joined": Now}); err != nil {
+				t.Fatal(err)
+			}
+			if err := Tags.Insert(Row{"tag": fmt.Sprintf("t%d", i), "count": i}); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err := Users.Insert(Row{"id": int64(3), "name": "x", "score": 1.0, "admin": true, "avatar": []byte{}, "joined": Now}); err == nil {
+			t.Fatalf("%v: Insert accepted a duplicate primary key", Format)
+		}
+		if err := Users.Insert(Row{"id": 3, "name": "x"}); err == nil {
+			t.Fatalf("%v: Insert accepted an int for an int64 column", Format)
+		}
+		if err := db.Insert("plain", "record"); err != nil {
+			t.Fatal(err)
+		}
+		var Big string = strings.Repeat("y", 5000)
+		if err := Users.Update(Row{"id": int64(5), "name": Big, "score": 2.5, "admin": false, "avatar": []byte("a"), "joined": Now}); err != nil {
+			t.Fatal(err)
+		}
+		if err := Users.Delete(int64(7)); err != nil {
+			t.Fatal(err)
+		}
+		if Format != MemoryFormat {
+			if err := db.Close(); err != nil {
+				t.Fatal(err)
+			}
+			db = openTest(t, Path)
+			if Users, err = db.Table("users"); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		Row, err := Users.Get(int64(5))
+		if err != nil || Row["name"] != Big || Row["score"] != 2.5 || Row["joined"] != Now {
+			t.Fatalf("%v: Get 5 = score %v, joined %v, %v", Format, Row["score"], Row["joined"], err)
+		}
+		Row, err = Users.Get(int64(4))
+		if err != nil || Row["name"] != "user 4|x" || Row["admin"] != true || string(Row["avatar"].([]byte)) != "\x00\x04\n" {
+			t.Fatalf("%v: Get 4 = %v, %v", Format, Row, err)
+		}
+		if Row, err := Users.Get(int64(7)); err != nil || Row != nil {
+			t.Fatalf("%v: Get of a deleted row = %v, %v", Format, Row, err)
+		}
+		if _, err := db.Table("tags"); err != nil {
+			t.Fatal(err)
+		}
+		if Record, err := db.Get("plain"); err != nil || Record == nil || Record.Fields[1] != "record" {
+			t.Fatalf("%v: plain record beside the tables lost: %v", Format, err)
+		}
+		db.Close()
+	}
+}
+
+func TestTableKeysSortByValue(t *testing.T) {
+	db, err := OpenInMemory(WithBTreeOrder(4))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	People, err := db.CreateTable("people", Schema{Columns: []Column{{"id", Int64Type}, {"age", Int64Type}, {"born", TimestampType}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var Base time.Time = time.Date(2000, 1, 1, 0, 0, 0, 0, time.UTC)
+	for i := int64(-20); i < 20; i++ {
+		if err := People.Insert(Row{"id": i, "age": i % 7, "born": Base.Add(time.Duration(i) * time.Hour)}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := People.Insert(Row{"id": int64(3), "age": int64(1), "born": Base}); err == nil || !strings.Contains(err.Error(), "(3)") {
+		t.Fatalf("duplicate key error does not name the decoded key: %v", err)
+	}
+	if err := People.Delete(int64(99)); err == nil {
+		t.Fatal("Delete of a missing row succeeded")
+	}
+
+	// Negative IDs sort before positive ones.
+	var Cursor *Cursor = People.Index.Cursor()
+	var Last int64 = -100
+	for Valid := Cursor.First(); Valid; Valid = Cursor.Next() {
+		Values, err := keyenc.Decode(Cursor.Key())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if Values[0].(int64) <= Last {
+			t.Fatalf("primary key %d follows %d", Values[0], Last)
+		}
+		Last = Values[0].(int64)
+	}
+	if Last != 19 {
+		t.Fatalf("last primary key is %d, want 19", Last)
+	}
+}
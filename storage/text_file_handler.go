@@ -4,36 +4,27 @@ import (
 	"bufio"
 	"fmt"
 	"os"
+	"slices"
 	"strings"
 	"sync"
 )
 
 // TextFileHandler manages the low-level reading and writing of pages to the database file.
+// Every write replaces the whole file through a synced temporary file, so the file
+// is always complete on disk, whatever the SyncMode short of SyncOff.
 type TextFileHandler struct {
 	FilePath         string
 	File             *os.File
+	SyncMode         SyncMode
 	Mutex            sync.RWMutex
-	PageSize         int
-	PageCount        uint
+	pageSize         int
+	pageCount        uint
+	checkpointLSN    uint64
 	DeallocatedPages []uint
 }
 
-// PageHeader contains metadata for a page.
-type PageHeader struct {
-	PageLSN  uint64
-	PageID   uint
-	PageType string
-}
-
-// Page represents a single page in the database file, which can hold data, index nodes, etc.
-type Page struct {
-	Header PageHeader
-	Data   map[string]string
-}
-
 const HeaderSection string = "# DATABASE HEADER"
 const PageSection string = "# PAGE"
-const DefaultPageSize int = 4096 // bytes
 
 // NewTextFileHandler creates a new handler for the database file.
 // It either creates a new file or opens an existing one.
@@ -52,6 +43,14 @@ func NewTextFileHandler(FilePath string) (*TextFileHandler, error) {
 			File.Close()
 			return nil, fmt.Errorf("Failed to initialize database file: %w", Error)
 		}
+		if Error = File.Sync(); Error != nil {
+			File.Close()
+			return nil, fmt.Errorf("Failed to sync database file: %w", Error)
+		}
+		if Error = syncDirectory(FilePath); Error != nil {
+			File.Close()
+			return nil, Error
+		}
 	} else {
 		File, Error = os.OpenFile(FilePath, os.O_RDWR, 0644)
 		if Error != nil {
@@ -62,8 +61,8 @@ func NewTextFileHandler(FilePath string) (*TextFileHandler, error) {
 	var FileHandler *TextFileHandler = &TextFileHandler{
 		FilePath:         FilePath,
 		File:             File,
-		PageSize:         DefaultPageSize,
-		PageCount:        0,
+		pageSize:         DefaultPageSize,
+		pageCount:        0,
 		DeallocatedPages: []uint{},
 	}
 
@@ -76,6 +75,8 @@ func NewTextFileHandler(FilePath string) (*TextFileHandler, error) {
 }
 
 // LoadMetadata reads the header of the database file to load configuration.
+// The page count is taken from the highest PageID in the file if the header is behind,
+// which older versions left at PAGES=0.
 func (self *TextFileHandler) LoadMetadata() error {
 	self.File.Seek(0, 0)
 	var Scanner *bufio.Scanner = bufio.NewScanner(self.File)
@@ -87,7 +88,15 @@ func (self *TextFileHandler) LoadMetadata() error {
 			InHeader = true
 			continue
 		} else if strings.HasPrefix(CurrentLine, PageSection) {
-			break
+			InHeader = false
+			continue
+		}
+
+		if !InHeader && strings.HasPrefix(CurrentLine, "PageID: ") {
+			var PageID uint
+			fmt.Sscanf(strings.TrimPrefix(CurrentLine, "PageID: "), "%d", &PageID)
+			self.pageCount = max(self.pageCount, PageID)
+			continue
 		}
 
 		if InHeader && CurrentLine != "" {
@@ -98,10 +107,15 @@ func (self *TextFileHandler) LoadMetadata() error {
 			var Key, Value string = strings.TrimSpace(Metadata[0]), strings.TrimSpace(Metadata[1])
 			switch Key {
 			case "PAGESIZE":
-				fmt.Sscanf(Value, "%d", &self.PageSize)
+				fmt.Sscanf(Value, "%d", &self.pageSize)
 			case "PAGES":
-				fmt.Sscanf(Value, "%d", &self.PageCount)
+				fmt.Sscanf(Value, "%d", &self.pageCount)
+			case "CHECKPOINT_LSN":
+				fmt.Sscanf(Value, "%d", &self.checkpointLSN)
 			case "DEALLOCATED_PAGES":
+				if Value == "" {
+					continue
+				}
 				for _, Page := range strings.Split(Value, ",") {
 					var PageID uint
 					fmt.Sscanf(Page, "%d", &PageID)
@@ -113,13 +127,86 @@ func (self *TextFileHandler) LoadMetadata() error {
 	return Scanner.Err()
 }
 
+// headerString renders the "# DATABASE HEADER" section from the handler's current state.
+func (self *TextFileHandler) headerString() string {
+	var Deallocated []string = make([]string, len(self.DeallocatedPages))
+	for i, PageID := range self.DeallocatedPages {
+		Deallocated[i] = fmt.Sprintf("%d", PageID)
+	}
+	return fmt.Sprintf("%s\nPAGESIZE=%d\nENCODING=UTF-8\nVERSION=1.0\nPAGES=%d\nCHECKPOINT_LSN=%d\nDEALLOCATED_PAGES=%s\n\n", HeaderSection, self.pageSize, self.pageCount, self.checkpointLSN, strings.Join(Deallocated, ","))
+}
+
+// writeHeader rewrites the header section of the file from the handler's current state.
+func (self *TextFileHandler) writeHeader() error {
+	Content, Error := os.ReadFile(self.FilePath)
+	if Error != nil {
+		return fmt.Errorf("Failed to read database file for writing: %w", Error)
+	}
+	return self.rewrite(self.replaceHeader(string(Content)))
+}
+
+// replaceHeader swaps the header section of FileContent for the current one.
+func (self *TextFileHandler) replaceHeader(FileContent string) string {
+	var HeaderEnd = strings.Index(FileContent, "\n"+PageSection+"\n")
+	if HeaderEnd == -1 {
+		HeaderEnd = len(FileContent)
+	}
+	return self.headerString() + FileContent[HeaderEnd:]
+}
+
+// rewrite replaces the whole database file with FileContent. The content goes to a
+// temporary file that is synced and renamed over the database file, so that a crash
+// leaves either the old file or the new one, never a file cut off halfway. Under
+// SyncOff the syncs are skipped, so only a crash of the process is covered.
+func (self *TextFileHandler) rewrite(FileContent string) error {
+	var TempPath string = self.FilePath + ".tmp"
+	Temp, Error := os.OpenFile(TempPath, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0644)
+	if Error != nil {
+		return fmt.Errorf("Failed to create temporary database file: %w", Error)
+	}
+	if _, Error = Temp.WriteString(FileContent); Error == nil {
+		Error = syncFile(Temp, self.SyncMode)
+	}
+	if Error == nil {
+		Error = os.Rename(TempPath, self.FilePath)
+	}
+	if Error != nil {
+		Temp.Close()
+		os.Remove(TempPath)
+		return fmt.Errorf("Failed to write to database file: %w", Error)
+	}
+
+	self.File.Close()
+	self.File = Temp
+	if self.SyncMode != SyncOff {
+		return syncDirectory(self.FilePath)
+	}
+	return nil
+}
+
+// CheckpointLSN returns the LSN of the last checkpoint recorded in the header.
+func (self *TextFileHandler) CheckpointLSN() uint64 {
+	self.Mutex.RLock()
+	defer self.Mutex.RUnlock()
+	return self.checkpointLSN
+}
+
+// SetCheckpointLSN records a checkpoint in the header and syncs the file.
+func (self *TextFileHandler) SetCheckpointLSN(LSN uint64) error {
+	self.Mutex.Lock()
+	defer self.Mutex.Unlock()
+
+	self.checkpointLSN = LSN
+	return self.writeHeader()
+}
+
 // ReadPage reads a specific page by its ID from the database file.
 func (self *TextFileHandler) ReadPage(PageID uint) (*Page, error) {
 	self.Mutex.RLock()
 	defer self.Mutex.RUnlock()
 
-	if PageID == 0 || PageID > self.PageCount {
-		return nil, fmt.Errorf("Invalid PageID: %d, PageCount: %d", PageID, self.PageCount)
+	if PageID == 0 || PageID > self.pageCount {
+		return nil, fmt.Errorf("Invalid PageID: %d, PageCount: %d", PageID, self.pageCount)
 	}
 
 	self.File.Seek(0, 0)
@@ -144,17 +231,16 @@ func (self *TextFileHandler) ReadPage(PageID uint) (*Page, error) {
 			InTargetPage = false
 		}
 
-		if strings.Contains(CurrentLine, PageIDMarker) {
+		if CurrentLine == PageIDMarker {
 			InTargetPage = true
 			PageFound = true
 		}
 
 		if InTargetPage && CurrentLine != "" {
-			var Parts []string = strings.SplitN(CurrentLine, ": ", 2)
-			if len(Parts) != 2 {
+			var Key, Value, IsField = splitLine(CurrentLine)
+			if !IsField {
 				continue
 			}
-			var Key, Value string = strings.TrimSpace(Parts[0]), strings.TrimSpace(Parts[1])
 			switch Key {
 			case "LSN":
 				fmt.Sscanf(Value, "%d", &Page.Header.PageLSN)
@@ -169,35 +255,32 @@ func (self *TextFileHandler) ReadPage(PageID uint) (*Page, error) {
 	}
 
 	if !PageFound {
-		return nil, fmt.Errorf("Page %d not found", PageID)
+		return nil, fmt.Errorf("%w: PageID %d", ErrPageNotFound, PageID)
 	}
 
 	return Page, Scanner.Err()
 }
 
 // WritePage writes a page's content to the database file.
+// It returns ErrPageOverflow if the page is larger than PageSize.
 func (self *TextFileHandler) WritePage(Page *Page) error {
 	self.Mutex.Lock()
 	defer self.Mutex.Unlock()
 
+	if Size := Page.Size(); Size > self.pageSize {
+		return fmt.Errorf("%w: page %d is %d bytes, limit is %d", ErrPageOverflow, Page.Header.PageID, Size, self.pageSize)
+	}
+
 	Content, Error := os.ReadFile(self.FilePath)
 	if Error != nil {
 		return fmt.Errorf("Failed to read database file for writing: %w", Error)
 	}
 	var FileContent string = string(Content)
 
-	var PageContentBuffer strings.Builder
-	PageContentBuffer.WriteString(fmt.Sprintf("%s\n", PageSection))
-	PageContentBuffer.WriteString(fmt.Sprintf("PageID: %d\n", Page.Header.PageID))
-	PageContentBuffer.WriteString(fmt.Sprintf("LSN: %d\n", Page.Header.PageLSN))
-	PageContentBuffer.WriteString(fmt.Sprintf("Type: %s\n", Page.Header.PageType))
-
-	for Key, Value := range Page.Data {
-		PageContentBuffer.WriteString(fmt.Sprintf("%s: %s\n", Key, Value))
-	}
-	var NewPageContent string = PageContentBuffer.String()
+	var NewPageContent string = formatPage(Page)
 
-	var PageIDMarker = fmt.Sprintf("PageID: %d", Page.Header.PageID)
+	// Match the whole line so that PageID 1 does not match PageID 10.
+	var PageIDMarker = fmt.Sprintf("\nPageID: %d\n", Page.Header.PageID)
 	var StartIndex = strings.Index(FileContent, PageIDMarker)
 
 	if StartIndex != -1 {
@@ -215,36 +298,73 @@ func (self *TextFileHandler) WritePage(Page *Page) error {
 		FileContent += "\n" + NewPageContent
 	}
 
-	// Update Page Count in header if necessary
-	if Page.Header.PageID > self.PageCount {
-		var OldPageCountString = fmt.Sprintf("PAGES=%d", self.PageCount)
-		self.PageCount = Page.Header.PageID
-		var NewPageCountString = fmt.Sprintf("PAGES=%d", self.PageCount)
-		FileContent = strings.Replace(FileContent, OldPageCountString, NewPageCountString, 1)
+	// Update Page Count in header if necessary. AllocatePage has usually counted the
+	// page already, so the header is always rewritten from the current state.
+	if Page.Header.PageID > self.pageCount {
+		self.pageCount = Page.Header.PageID
 	}
+	return self.rewrite(self.replaceHeader(FileContent))
+}
 
-	if Error = self.File.Truncate(0); Error != nil {
-		return fmt.Errorf("Failed to truncate database file: %w", Error)
-	}
-	self.File.Seek(0, 0)
-	if _, Error = self.File.WriteString(FileContent); Error != nil {
-		return fmt.Errorf("Failed to write to database file: %w", Error)
+// formatPage renders a page as a "# PAGE" section of the text file format.
+func formatPage(Page *Page) string {
+	var PageContentBuffer strings.Builder
+	PageContentBuffer.WriteString(fmt.Sprintf("%s\n", PageSection))
+	PageContentBuffer.WriteString(fmt.Sprintf("PageID: %d\n", Page.Header.PageID))
+	PageContentBuffer.WriteString(fmt.Sprintf("LSN: %d\n", Page.Header.PageLSN))
+	PageContentBuffer.WriteString(fmt.Sprintf("Type: %s\n", escapeValue(Page.Header.PageType, "")))
+
+	for Key, Value := range Page.Data {
+		PageContentBuffer.WriteString(fmt.Sprintf("%s: %s\n", escapeValue(Key, ":"), escapeValue(Value, "")))
 	}
+	return PageContentBuffer.String()
+}
 
-	return nil
+// PageSize returns the size of a page in bytes.
+func (self *TextFileHandler) PageSize() int {
+	return self.pageSize
 }
 
-// Close flushes and closes the database file.
+// PageCount returns the highest PageID allocated so far.
+func (self *TextFileHandler) PageCount() uint {
+	self.Mutex.RLock()
+	defer self.Mutex.RUnlock()
+	return self.pageCount
+}
+
+// IsDeallocated reports whether a page is on the deallocated list.
+func (self *TextFileHandler) IsDeallocated(PageID uint) bool {
+	self.Mutex.RLock()
+	defer self.Mutex.RUnlock()
+	return slices.Contains(self.DeallocatedPages, PageID)
+}
+
+// Sync commits the database file to stable storage, unless SyncMode is SyncOff.
+func (self *TextFileHandler) Sync() error {
+	self.Mutex.Lock()
+	defer self.Mutex.Unlock()
+	return syncFile(self.File, self.SyncMode)
+}
+
+// Close syncs and closes the database file.
 func (self *TextFileHandler) Close() error {
 	self.Mutex.Lock()
 	defer self.Mutex.Unlock()
-	if self.File != nil {
-		return self.File.Close()
+	if self.File == nil {
+		return nil
 	}
-	return nil
+	var SyncErr error = syncFile(self.File, self.SyncMode)
+	if Error := self.File.Close(); Error != nil {
+		return Error
+	}
+	return SyncErr
 }
 
-// AllocatePage finds an available page ID to use for new data.
+// AllocatePage finds an available page ID to use for new data. A reused page is
+// taken off the DEALLOCATED_PAGES header line straight away, so that it cannot be
+// handed out twice if its first write never reaches the file. Since rewrite syncs
+// the file, the header is on disk before the transaction that reuses the page can
+// commit, and the page is not listed as free after a power loss.
 func (self *TextFileHandler) AllocatePage() (*Page, error) {
 	self.Mutex.Lock()
 	defer self.Mutex.Unlock()
@@ -253,10 +373,13 @@ func (self *TextFileHandler) AllocatePage() (*Page, error) {
 	if len(self.DeallocatedPages) > 0 {
 		PageID = self.DeallocatedPages[0]
 		self.DeallocatedPages = self.DeallocatedPages[1:]
-		// TODO: Update deallocated pages list in file header
+		if Error := self.writeHeader(); Error != nil {
+			self.DeallocatedPages = slices.Insert(self.DeallocatedPages, 0, PageID)
+			return nil, Error
+		}
 	} else {
-		self.PageCount++
-		PageID = self.PageCount
+		self.pageCount++
+		PageID = self.pageCount
 	}
 
 	var NewPage *Page = &Page{
@@ -267,3 +390,23 @@ func (self *TextFileHandler) AllocatePage() (*Page, error) {
 	}
 	return NewPage, nil
 }
+
+// FreePage returns a page to the deallocated list so that AllocatePage can reuse it,
+// and records the list in the header so that the page is still reused after a restart.
+func (self *TextFileHandler) FreePage(PageID uint) error {
+	self.Mutex.Lock()
+	defer self.Mutex.Unlock()
+
+	if PageID == 0 || PageID > self.pageCount {
+		return fmt.Errorf("Invalid PageID: %d, PageCount: %d", PageID, self.pageCount)
+	}
+	if slices.Contains(self.DeallocatedPages, PageID) {
+		return fmt.Errorf("Page %d is already deallocated", PageID)
+	}
+	self.DeallocatedPages = append(self.DeallocatedPages, PageID)
+	if Error := self.writeHeader(); Error != nil {
+		self.DeallocatedPages = self.DeallocatedPages[:len(self.DeallocatedPages)-1]
+		return Error
+	}
+	return nil
+}
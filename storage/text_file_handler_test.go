@@ -0,0 +1,48 @@
+package storage
+
+import (
+	"fmt"
+	"os"
+	"testing"
+)
+
+func TestTextFileHandlerSurvivesTornRewrite(t *testing.T) {
+	var Path string = testPath(t)
+	db := openTest(t, Path, WithFormat(TextFormat))
+	insertKeys(t, db, "k", 50, "v")
+	if err := db.Checkpoint(); err != nil {
+		t.Fatal(err)
+	}
+	Before, err := os.ReadFile(Path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Insert("one", "more"); err != nil {
+		t.Fatal(err)
+	}
+	// A crash halfway through the next rewrite leaves a torn temporary file beside
+	// the intact database file.
+	if err := os.WriteFile(Path+".tmp", Before[:len(Before)/2], 0644); err != nil {
+		t.Fatal(err)
+	}
+	crash(db)
+
+	db = openTest(t, Path)
+	for i := 0; i < 50; i++ {
+		if Record, _ := db.Get(fmt.Sprintf("k%03d", i)); Record == nil {
+			t.Fatalf("k%03d lost", i)
+		}
+	}
+	if Record, _ := db.Get("one"); Record == nil {
+		t.Fatal("committed record lost")
+	}
+	if err := db.Insert("two", "v"); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(Path + ".tmp"); !os.IsNotExist(err) {
+		t.Fatalf("temporary file left behind: %v", err)
+	}
+}
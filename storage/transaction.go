@@ -0,0 +1,113 @@
+package storage
+
+import "errors"
+
+// ErrTxDone is returned by a Tx that has already been committed or rolled back.
+var ErrTxDone = errors.New("transaction has already been committed or rolled back")
+
+// Tx groups several changes so that they become visible, and durable, all at once
+// or not at all. A Tx holds the database's write lock from Begin until Commit or
+// Rollback, so other writers wait for it to finish; readers keep seeing the last
+// commit in the meantime.
+//
+// A change that fails inside a transaction is undone on its own and the
+// transaction stays open; the caller decides whether to commit the rest.
+type Tx struct {
+	DB   *Database
+	done bool
+}
+
+// Begin starts a transaction.
+func (db *Database) Begin() (*Tx, error) {
+	db.Mutex.Lock()
+	if err := db.Log.Begin(); err != nil {
+		db.Mutex.Unlock()
+		return nil, err
+	}
+	return &Tx{DB: db}, nil
+}
+
+// Get retrieves a record by its ID, including changes made earlier in the transaction.
+func (tx *Tx) Get(ID string) (*Record, error) {
+	if tx.done {
+		return nil, ErrTxDone
+	}
+	return tx.DB.get(ID)
+}
+
+// Insert adds a record as part of the transaction.
+func (tx *Tx) Insert(ID string, Data string) error {
+	return tx.change(func() error {
+		if err := checkPlainID(ID); err != nil {
+			return err
+		}
+		return tx.DB.insert(ID, Data)
+	})
+}
+
+// InsertBatch adds several records as part of the transaction, indexing them in
+// parallel like Database.InsertBatch. If any record cannot be added, none of them are.
+func (tx *Tx) InsertBatch(Records map[string]string) error {
+	return tx.change(func() error {
+		return tx.DB.insertBatch(Records)
+	})
+}
+
+// Update changes the data for an existing record as part of the transaction.
+func (tx *Tx) Update(ID string, NewData string) error {
+	return tx.change(func() error {
+		return tx.DB.update(ID, NewData)
+	})
+}
+
+// Delete removes a record as part of the transaction.
+func (tx *Tx) Delete(ID string) error {
+	return tx.change(func() error {
+		return tx.DB.delete(ID)
+	})
+}
+
+// Commit makes the transaction's changes permanent and releases the write lock.
+// If the commit cannot be logged, the changes are rolled back instead. An error
+// from the automatic checkpoint that may follow does not undo the commit.
+func (tx *Tx) Commit() error {
+	if tx.done {
+		return ErrTxDone
+	}
+	defer tx.finish()
+
+	if err := tx.DB.Log.Commit(); err != nil {
+		return errors.Join(err, tx.DB.abort())
+	}
+	return tx.DB.autoCheckpoint()
+}
+
+// Rollback undoes the transaction's changes and releases the write lock.
+func (tx *Tx) Rollback() error {
+	if tx.done {
+		return ErrTxDone
+	}
+	defer tx.finish()
+	return tx.DB.abort()
+}
+
+// change runs one change of the transaction, undoing just that change if it fails.
+func (tx *Tx) change(Change func() error) error {
+	if tx.done {
+		return ErrTxDone
+	}
+	var Savepoint Savepoint = tx.DB.Log.Savepoint()
+	if err := Change(); err != nil {
+		if RollbackErr := tx.DB.Log.RollbackTo(Savepoint); RollbackErr != nil {
+			return errors.Join(err, RollbackErr)
+		}
+		return errors.Join(err, tx.DB.reload())
+	}
+	return nil
+}
+
+// finish marks the transaction done and releases the write lock.
+func (tx *Tx) finish() {
+	tx.done = true
+	tx.DB.Mutex.Unlock()
+}
@@ -0,0 +1,85 @@
+package storage
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestTxRollbackAndCommit(t *testing.T) {
+	for _, Path := range []string{MemoryFilePath, testPath(t)} {
+		db := openTest(t, Path, WithBTreeOrder(4))
+		insertKeys(t, db, "k", 50, "v")
+
+		tx, err := db.Begin()
+		if err != nil {
+			t.Fatal(err)
+		}
+		for i := 50; i < 300; i++ {
+			if err := tx.Insert(fmt.Sprintf("k%03d", i), strings.Repeat("z", i)); err != nil {
+				t.Fatal(err)
+			}
+		}
+		for i := 0; i < 25; i++ {
+			if err := tx.Delete(fmt.Sprintf("k%03d", i)); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err := tx.Insert("k049", "duplicate"); err == nil {
+			t.Fatalf("%s: Insert accepted a duplicate ID", Path)
+		}
+		if err := tx.Insert(strings.Repeat("Q", 5000), "big"); err == nil {
+			t.Fatalf("%s: Insert accepted an oversized ID", Path)
+		}
+		if Record, _ := tx.Get("k100"); Record == nil {
+			t.Fatalf("%s: transaction does not see its own insert", Path)
+		}
+		if err := tx.Rollback(); err != nil {
+			t.Fatal(err)
+		}
+		if err := tx.Commit(); !errors.Is(err, ErrTxDone) {
+			t.Fatalf("%s: Commit after Rollback: %v", Path, err)
+		}
+		if Count := countKeys(t, db.Index); Count != 50 {
+			t.Fatalf("%s: index holds %d keys after rollback, want 50", Path, Count)
+		}
+		if Record, _ := db.Get("k100"); Record != nil {
+			t.Fatalf("%s: rolled-back insert is visible", Path)
+		}
+		if Record, _ := db.Get("k010"); Record == nil {
+			t.Fatalf("%s: rolled-back delete removed k010", Path)
+		}
+
+		tx, err = db.Begin()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := tx.Insert("new1", "a"); err != nil {
+			t.Fatal(err)
+		}
+		if err := tx.Update("k001", strings.Repeat("u", 3000)); err != nil {
+			t.Fatal(err)
+		}
+		if err := tx.Delete("k002"); err != nil {
+			t.Fatal(err)
+		}
+		if err := tx.Commit(); err != nil {
+			t.Fatal(err)
+		}
+		if Path != MemoryFilePath {
+			crash(db)
+			db = openTest(t, Path)
+		}
+		if Count := countKeys(t, db.Index); Count != 50 {
+			t.Fatalf("%s: index holds %d keys after commit, want 50", Path, Count)
+		}
+		if Record, _ := db.Get("k001"); Record == nil || len(Record.Fields[1]) != 3000 {
+			t.Fatalf("%s: committed update lost", Path)
+		}
+		if Record, _ := db.Get("k002"); Record != nil {
+			t.Fatalf("%s: committed delete lost", Path)
+		}
+		db.Close()
+	}
+}
@@ -0,0 +1,154 @@
+package storage
+
+import (
+	"fmt"
+	"strings"
+
+	"twoDB/keyenc"
+)
+
+// The Tuple methods are the Database API for records whose IDs are tuples of values
+// rather than plain strings. The ID stored in the index, and in Fields[0] of the
+// record, is TuplePrefix followed by the keyenc encoding of the tuple, so records
+// scan in the order of their values: numeric IDs sort by value rather than as text,
+// and a composite ID such as (tenant, createdAt) lists a tenant's records by time.
+// DecodeTuple turns a stored ID back into values.
+//
+// Tuple IDs share the index with plain string IDs. No plain ID can start with
+// TuplePrefix, so the tuple IDs sort together before every plain ID, and a range
+// scan with an open end stops at the last of them.
+
+// TuplePrefix is the first byte of every tuple ID. It is reserved: Insert rejects
+// plain IDs that start with it.
+const TuplePrefix = "\x00"
+
+// InsertTuple adds a record whose ID is the encoding of Key.
+func (db *Database) InsertTuple(Key []any, Data string) error {
+	ID, err := tupleID(Key)
+	if err != nil {
+		return err
+	}
+	db.Mutex.Lock()
+	defer db.Mutex.Unlock()
+	return db.logged(func() error {
+		return db.insert(ID, Data)
+	})
+}
+
+// GetTuple retrieves the record whose ID is the encoding of Key, or nil if there is
+// none. Like Get, it reads from a snapshot of the latest commit.
+func (db *Database) GetTuple(Key ...any) (*Record, error) {
+	Snapshot, err := db.BeginRead()
+	if err != nil {
+		return nil, err
+	}
+	defer Snapshot.Close()
+	return Snapshot.GetTuple(Key...)
+}
+
+// UpdateTuple changes the data of the record whose ID is the encoding of Key.
+func (db *Database) UpdateTuple(Key []any, NewData string) error {
+	ID, err := tupleID(Key)
+	if err != nil {
+		return err
+	}
+	return db.Update(ID, NewData)
+}
+
+// DeleteTuple removes the record whose ID is the encoding of Key.
+func (db *Database) DeleteTuple(Key ...any) error {
+	ID, err := tupleID(Key)
+	if err != nil {
+		return err
+	}
+	return db.Delete(ID)
+}
+
+// ScanTuple returns the records whose tuple IDs fall in [Start, End), in tuple
+// order. A nil Start or End leaves that end of the range open. A longer tuple sorts
+// right after its prefix, so Start includes the IDs that extend it and End
+// excludes them.
+func (db *Database) ScanTuple(Start []any, End []any) ([]*Record, error) {
+	Snapshot, err := db.BeginRead()
+	if err != nil {
+		return nil, err
+	}
+	defer Snapshot.Close()
+	return Snapshot.ScanTuple(Start, End)
+}
+
+// ScanPrefix returns the records whose tuple IDs start with the values of Prefix,
+// in tuple order.
+func (db *Database) ScanPrefix(Prefix ...any) ([]*Record, error) {
+	Snapshot, err := db.BeginRead()
+	if err != nil {
+		return nil, err
+	}
+	defer Snapshot.Close()
+	return Snapshot.ScanPrefix(Prefix...)
+}
+
+// GetTuple retrieves the record whose ID is the encoding of Key as of the snapshot.
+func (tx *ReadTx) GetTuple(Key ...any) (*Record, error) {
+	ID, err := tupleID(Key)
+	if err != nil {
+		return nil, err
+	}
+	return tx.Get(ID)
+}
+
+// ScanTuple returns the records whose tuple IDs fall in [Start, End) as of the
+// snapshot. A nil Start or End leaves that end of the range open, at the first or
+// last tuple ID; plain IDs are never included.
+func (tx *ReadTx) ScanTuple(Start []any, End []any) ([]*Record, error) {
+	var StartKey string = TuplePrefix
+	var EndKey string = PrefixEnd(TuplePrefix)
+	var err error
+	if Start != nil {
+		if StartKey, err = tupleID(Start); err != nil {
+			return nil, err
+		}
+	}
+	if End != nil {
+		if EndKey, err = tupleID(End); err != nil {
+			return nil, err
+		}
+	}
+	return tx.Scan(StartKey, EndKey)
+}
+
+// ScanPrefix returns the records whose tuple IDs start with the values of Prefix as
+// of the snapshot.
+func (tx *ReadTx) ScanPrefix(Prefix ...any) ([]*Record, error) {
+	StartKey, err := tupleID(Prefix)
+	if err != nil {
+		return nil, err
+	}
+	return tx.Scan(StartKey, PrefixEnd(StartKey))
+}
+
+// DecodeTuple returns the values of a tuple ID, such as Fields[0] of a record
+// stored with InsertTuple.
+func DecodeTuple(ID string) ([]any, error) {
+	if !strings.HasPrefix(ID, TuplePrefix) {
+		return nil, fmt.Errorf("'%s' is not a tuple ID", ID)
+	}
+	return keyenc.Decode(ID[len(TuplePrefix):])
+}
+
+// tupleID returns the ID under which a record keyed by the tuple Key is stored.
+func tupleID(Key []any) (string, error) {
+	Encoded, err := keyenc.Encode(Key...)
+	if err != nil {
+		return "", err
+	}
+	return TuplePrefix + Encoded, nil
+}
+
+// checkPlainID rejects a plain ID that would be taken for a tuple ID.
+func checkPlainID(ID string) error {
+	if strings.HasPrefix(ID, TuplePrefix) {
+		return fmt.Errorf("record IDs cannot start with the tuple ID prefix %q", TuplePrefix)
+	}
+	return nil
+}
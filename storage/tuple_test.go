@@ -0,0 +1,106 @@
+package storage
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"twoDB/keyenc"
+)
+
+func TestTupleKeys(t *testing.T) {
+	db, err := OpenInMemory()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	var Now time.Time = time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	for _, Tenant := range []string{"b", "a"} {
+		for i := 12; i >= 0; i-- {
+			if err := db.InsertTuple([]any{Tenant, Now.Add(time.Duration(i) * time.Hour)}, fmt.Sprint(i)); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	if err := db.Insert("user:2", "plain"); err != nil {
+		t.Fatal(err)
+	}
+
+	Records, err := db.ScanPrefix("a")
+	if err != nil || len(Records) != 13 {
+		t.Fatalf("ScanPrefix(a) returned %d records, %v", len(Records), err)
+	}
+	for i, Record := range Records {
+		if Record.Fields[1] != fmt.Sprint(i) {
+			t.Fatalf("record %d of tenant a holds %q", i, Record.Fields[1])
+		}
+	}
+	Records, err = db.ScanTuple([]any{"a", Now.Add(3 * time.Hour)}, []any{"a", Now.Add(5 * time.Hour)})
+	if err != nil || len(Records) != 2 || Records[0].Fields[1] != "3" {
+		t.Fatalf("ScanTuple over hours 3 to 5 returned %d records, %v", len(Records), err)
+	}
+	if Records, _ := db.ScanTuple([]any{"b"}, []any{"c"}); len(Records) != 13 {
+		t.Fatalf("ScanTuple over tenant b returned %d records", len(Records))
+	}
+
+	// Open ends stop at the tuple IDs, which sort apart from plain IDs such as
+	// user:2, whatever their type codes.
+	if Records, _ := db.ScanTuple([]any{"b", Now.Add(10 * time.Hour)}, nil); len(Records) != 3 {
+		t.Fatalf("ScanTuple with an open end returned %d records, want 3", len(Records))
+	}
+	if err := db.InsertTuple([]any{keyenc.Desc{Value: int64(5)}}, "desc"); err != nil {
+		t.Fatal(err)
+	}
+	if Records, _ := db.ScanTuple(nil, nil); len(Records) != 27 {
+		t.Fatalf("ScanTuple over every tuple returned %d records, want 27", len(Records))
+	}
+	if err := db.Insert(TuplePrefix+"fake", "v"); err == nil {
+		t.Fatal("Insert accepted a plain ID with the tuple prefix")
+	}
+
+	if err := db.UpdateTuple([]any{"a", Now}, "zero"); err != nil {
+		t.Fatal(err)
+	}
+	Record, err := db.GetTuple("a", Now)
+	if err != nil || Record == nil || Record.Fields[1] != "zero" {
+		t.Fatalf("GetTuple after UpdateTuple = %v, %v", Record, err)
+	}
+	Values, err := DecodeTuple(Record.Fields[0])
+	if err != nil || len(Values) != 2 || Values[0] != "a" || !Values[1].(time.Time).Equal(Now) {
+		t.Fatalf("stored ID decodes to %v, %v", Values, err)
+	}
+	if err := db.DeleteTuple("a", Now); err != nil {
+		t.Fatal(err)
+	}
+	if Record, _ := db.GetTuple("a", Now); Record != nil {
+		t.Fatal("GetTuple found a deleted record")
+	}
+	if Record, _ := db.Get("user:2"); Record == nil {
+		t.Fatal("plain ID lost beside the tuple IDs")
+	}
+}
+
+func TestTupleKeysSortNumerically(t *testing.T) {
+	db, err := OpenInMemory()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	for i := 12; i >= 1; i-- {
+		if err := db.InsertTuple([]any{int64(i)}, fmt.Sprint(i)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	Records, err := db.ScanTuple([]any{int64(2)}, []any{int64(11)})
+	if err != nil || len(Records) != 9 {
+		t.Fatalf("ScanTuple over 2 to 11 returned %d records, %v", len(Records), err)
+	}
+	for i, Record := range Records {
+		if Record.Fields[1] != fmt.Sprint(i+2) {
+			t.Fatalf("record %d holds %q, want %d", i, Record.Fields[1], i+2)
+		}
+	}
+	if Records, _ := db.ScanTuple(nil, []any{int64(3)}); len(Records) != 2 {
+		t.Fatalf("ScanTuple with an open start returned %d records, want 2", len(Records))
+	}
+}
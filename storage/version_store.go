@@ -0,0 +1,169 @@
+package storage
+
+import (
+	"fmt"
+	"math"
+	"sync"
+)
+
+// pendingLSN marks a page version whose replacement has not committed yet.
+const pendingLSN uint64 = math.MaxUint64
+
+// pageVersion is an old image of a page, kept for readers whose snapshot is older
+// than the change that replaced it.
+type pageVersion struct {
+	Page       *Page  // nil if the page was not allocated yet
+	ReplacedAt uint64 // LSN of the commit that replaced the page, or pendingLSN
+}
+
+// VersionStore keeps the committed images of pages that a transaction has since
+// changed, so that readers pinned to an older snapshot LSN still see the pages as
+// they were. The newest image is always the page in the store itself.
+//
+// For a snapshot at LSN S, a page is read from the oldest version replaced after S,
+// or from the store if there is none. Versions that no open snapshot can reach are
+// dropped whenever a transaction commits or a snapshot is released.
+type VersionStore struct {
+	Mutex        sync.RWMutex
+	versions     map[uint][]pageVersion // Oldest first
+	committedLSN uint64
+	snapshots    map[uint64]int // Open snapshots by LSN
+}
+
+// NewVersionStore creates an empty version store.
+func NewVersionStore() *VersionStore {
+	return &VersionStore{
+		versions:  make(map[uint][]pageVersion),
+		snapshots: make(map[uint64]int),
+	}
+}
+
+// Pin opens a snapshot at the latest committed LSN and returns that LSN.
+func (self *VersionStore) Pin() uint64 {
+	self.Mutex.Lock()
+	defer self.Mutex.Unlock()
+	self.snapshots[self.committedLSN]++
+	return self.committedLSN
+}
+
+// Unpin releases a snapshot opened by Pin.
+func (self *VersionStore) Unpin(LSN uint64) {
+	self.Mutex.Lock()
+	defer self.Mutex.Unlock()
+	if self.snapshots[LSN]--; self.snapshots[LSN] <= 0 {
+		delete(self.snapshots, LSN)
+	}
+	self.collect()
+}
+
+// ReadPage returns PageID as it was at snapshot LSN. It returns ErrPageNotFound for
+// a page that was allocated after the snapshot.
+func (self *VersionStore) ReadPage(Store PageStore, PageID uint, LSN uint64) (*Page, error) {
+	return self.read(Store, PageID, LSN, false)
+}
+
+// readAllocated is ReadPage for readers that walk pages by ID rather than through
+// an index. It also returns ErrPageNotFound for a page that was on the store's
+// deallocated list at the snapshot, since a freed page keeps its old contents.
+func (self *VersionStore) readAllocated(Store PageStore, PageID uint, LSN uint64) (*Page, error) {
+	return self.read(Store, PageID, LSN, true)
+}
+
+// read returns PageID as it was at snapshot LSN, checking the deallocated list if
+// SkipFreed is set. A page that is deallocated now and has no version replaced after
+// LSN was already free at LSN, since commits free pages under the write lock.
+func (self *VersionStore) read(Store PageStore, PageID uint, LSN uint64, SkipFreed bool) (*Page, error) {
+	self.Mutex.RLock()
+	defer self.Mutex.RUnlock()
+
+	for _, Version := range self.versions[PageID] {
+		if Version.ReplacedAt <= LSN {
+			continue
+		}
+		if Version.Page == nil {
+			return nil, fmt.Errorf("%w: PageID %d at LSN %d", ErrPageNotFound, PageID, LSN)
+		}
+		return Version.Page.clone(), nil
+	}
+	if SkipFreed {
+		if FreeList, Supported := freeListOf(Store); Supported && FreeList.IsDeallocated(PageID) {
+			return nil, fmt.Errorf("%w: PageID %d is deallocated", ErrPageNotFound, PageID)
+		}
+	}
+	return Store.ReadPage(PageID)
+}
+
+// preserve keeps the committed image of a page that the open transaction is about
+// to change for the first time. A nil image stands for a page the transaction
+// allocated, which older snapshots must not see. The caller holds the write lock.
+func (self *VersionStore) preserve(PageID uint, Committed *Page) {
+	var Versions []pageVersion = self.versions[PageID]
+	if len(Versions) > 0 && Versions[len(Versions)-1].ReplacedAt == pendingLSN {
+		return
+	}
+	var Version pageVersion = pageVersion{ReplacedAt: pendingLSN}
+	if Committed != nil {
+		Version.Page = Committed.clone()
+	}
+	self.versions[PageID] = append(Versions, Version)
+}
+
+// commit dates the versions preserved by the open transaction with its commit LSN.
+// Pages the transaction freed are preserved as well, since their IDs may be reused
+// before older snapshots are done with them. The caller holds the write lock.
+func (self *VersionStore) commit(LSN uint64, Store PageStore, Freed []uint) error {
+	for _, PageID := range Freed {
+		var Versions []pageVersion = self.versions[PageID]
+		if len(Versions) > 0 && Versions[len(Versions)-1].ReplacedAt == pendingLSN {
+			continue
+		}
+		Page, err := Store.ReadPage(PageID)
+		if err != nil {
+			return err
+		}
+		self.preserve(PageID, Page)
+	}
+	for _, Versions := range self.versions {
+		if Last := &Versions[len(Versions)-1]; Last.ReplacedAt == pendingLSN {
+			Last.ReplacedAt = LSN
+		}
+	}
+	self.committedLSN = LSN
+	self.collect()
+	return nil
+}
+
+// abort drops the versions preserved by the open transaction, whose changes have
+// been undone. The caller holds the write lock.
+func (self *VersionStore) abort() {
+	for PageID, Versions := range self.versions {
+		if Versions[len(Versions)-1].ReplacedAt != pendingLSN {
+			continue
+		}
+		if len(Versions) == 1 {
+			delete(self.versions, PageID)
+		} else {
+			self.versions[PageID] = Versions[:len(Versions)-1]
+		}
+	}
+}
+
+// collect drops the versions that were replaced before the oldest open snapshot.
+// The caller holds the write lock.
+func (self *VersionStore) collect() {
+	var Oldest uint64 = self.committedLSN
+	for LSN := range self.snapshots {
+		Oldest = min(Oldest, LSN)
+	}
+	for PageID, Versions := range self.versions {
+		var Keep int = 0
+		for Keep < len(Versions) && Versions[Keep].ReplacedAt <= Oldest {
+			Keep++
+		}
+		if Keep == len(Versions) {
+			delete(self.versions, PageID)
+		} else if Keep > 0 {
+			self.versions[PageID] = Versions[Keep:]
+		}
+	}
+}
@@ -0,0 +1,365 @@
+package storage
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"sync"
+)
+
+// WALSuffix is appended to a database's file path to name its write-ahead log.
+const WALSuffix string = ".wal"
+
+const WALMagic string = "twoDBwal"
+
+// walHeaderSize is the size of the log file header: the magic followed by the LSN
+// of the first record the file can hold.
+const walHeaderSize int = 16
+
+// walFrameSize is the size of the length and checksum in front of every record.
+const walFrameSize int = 8
+
+// LogRecordType tells recovery what a log record describes.
+type LogRecordType uint8
+
+const (
+	// LogBegin starts a transaction. Its LSN is the transaction's ID.
+	LogBegin LogRecordType = iota + 1
+	// LogUpdate replaces a page. Before is nil if the transaction allocated the page.
+	LogUpdate
+	// LogCommit makes a transaction's updates permanent.
+	LogCommit
+	// LogAbort ends a transaction whose updates have been undone.
+	LogAbort
+)
+
+// LogRecord is one entry of the write-ahead log. Updates carry whole page images:
+// After is what the page became and Before is what it was, so that the change can
+// be redone or undone without reading the page.
+type LogRecord struct {
+	LSN    uint64
+	TxID   uint64
+	Type   LogRecordType
+	PageID uint
+	Before *Page
+	After  *Page
+}
+
+// WriteAheadLog is an append-only file of LogRecords. Records are appended to the
+// file as they are logged and become durable when Flush syncs it.
+//
+// The file starts with a header holding WALMagic and the first LSN it can hold,
+// so that LSNs keep increasing after the log is emptied. Every record after it is
+// framed by a uint32 payload length and a CRC-32 of the payload; the payload holds
+// the uvarint LSN, TxID, type and PageID, a flags byte saying which images follow,
+// and the images in the slot format of BinaryFileHandler. A record that is cut
+// short or fails its checksum marks the end of the log.
+type WriteAheadLog struct {
+	FilePath   string
+	File       *os.File
+	SyncMode   SyncMode
+	Mutex      sync.Mutex
+	nextLSN    uint64
+	flushedLSN uint64
+	size       int64
+}
+
+// Flags stored with each record to say which page images it carries.
+const (
+	walHasBefore byte = 1 << iota
+	walHasAfter
+)
+
+// OpenWriteAheadLog opens the log at FilePath, creating it if it does not exist.
+// A new log hands out LSNs starting at StartLSN. An existing log continues after
+// its last intact record, and anything after that record is cut off. A file too
+// short to hold the header, which a crash while the log was being created or
+// emptied leaves behind, holds no records and is started again at StartLSN.
+func OpenWriteAheadLog(FilePath string, StartLSN uint64) (*WriteAheadLog, error) {
+	var Log *WriteAheadLog = &WriteAheadLog{FilePath: FilePath}
+
+	Info, Error := os.Stat(FilePath)
+	if os.IsNotExist(Error) {
+		Log.File, Error = os.Create(FilePath)
+		if Error != nil {
+			return nil, fmt.Errorf("Failed to create write-ahead log: %w", Error)
+		}
+		if Error = Log.reset(max(StartLSN, 1)); Error != nil {
+			Log.File.Close()
+			return nil, Error
+		}
+		if Error = syncDirectory(FilePath); Error != nil {
+			Log.File.Close()
+			return nil, Error
+		}
+		return Log, nil
+	}
+
+	Log.File, Error = os.OpenFile(FilePath, os.O_RDWR, 0644)
+	if Error != nil {
+		return nil, fmt.Errorf("Failed to open write-ahead log: %w", Error)
+	}
+	if Info.Size() < int64(walHeaderSize) {
+		if Error = Log.reset(max(StartLSN, 1)); Error != nil {
+			Log.File.Close()
+			return nil, Error
+		}
+		return Log, nil
+	}
+	if _, Error = Log.Records(); Error != nil {
+		Log.File.Close()
+		return nil, Error
+	}
+	return Log, nil
+}
+
+// Append adds a record to the end of the log, assigning it the next LSN and
+// stamping its After image with it.
+// The record is not durable until Flush is called with its LSN or a later one.
+func (self *WriteAheadLog) Append(Record *LogRecord) (uint64, error) {
+	self.Mutex.Lock()
+	defer self.Mutex.Unlock()
+
+	Record.LSN = self.nextLSN
+	if Record.Type == LogBegin {
+		Record.TxID = Record.LSN
+	}
+	if Record.After != nil {
+		Record.After.Header.PageLSN = Record.LSN
+	}
+
+	var Payload []byte = encodeLogRecord(Record)
+	var Frame []byte = make([]byte, walFrameSize, walFrameSize+len(Payload))
+	binary.LittleEndian.PutUint32(Frame[0:4], uint32(len(Payload)))
+	binary.LittleEndian.PutUint32(Frame[4:8], crc32.ChecksumIEEE(Payload))
+	Frame = append(Frame, Payload...)
+
+	if _, Error := self.File.WriteAt(Frame, self.size); Error != nil {
+		return 0, fmt.Errorf("Failed to append to write-ahead log: %w", Error)
+	}
+	self.size += int64(len(Frame))
+	self.nextLSN++
+	return Record.LSN, nil
+}
+
+// Flush makes every record up to and including LSN durable. Under SyncOff it only
+// marks them flushed.
+func (self *WriteAheadLog) Flush(LSN uint64) error {
+	self.Mutex.Lock()
+	defer self.Mutex.Unlock()
+
+	if LSN <= self.flushedLSN {
+		return nil
+	}
+	if Error := syncFile(self.File, self.SyncMode); Error != nil {
+		return fmt.Errorf("Failed to sync write-ahead log: %w", Error)
+	}
+	self.flushedLSN = self.nextLSN - 1
+	return nil
+}
+
+// FlushAll makes every record appended so far durable.
+func (self *WriteAheadLog) FlushAll() error {
+	self.Mutex.Lock()
+	var Last uint64 = self.nextLSN - 1
+	self.Mutex.Unlock()
+	return self.Flush(Last)
+}
+
+// Size returns the size of the log file in bytes.
+func (self *WriteAheadLog) Size() int64 {
+	self.Mutex.Lock()
+	defer self.Mutex.Unlock()
+	return self.size
+}
+
+// Truncate empties the log. LSNs continue from where they were.
+func (self *WriteAheadLog) Truncate() error {
+	self.Mutex.Lock()
+	defer self.Mutex.Unlock()
+	return self.reset(self.nextLSN)
+}
+
+// NextLSN returns the LSN the next appended record will get.
+func (self *WriteAheadLog) NextLSN() uint64 {
+	self.Mutex.Lock()
+	defer self.Mutex.Unlock()
+	return self.nextLSN
+}
+
+// Records reads every intact record in the log, oldest first. A torn or corrupt
+// record ends the log; it and everything after it are removed from the file.
+func (self *WriteAheadLog) Records() ([]*LogRecord, error) {
+	self.Mutex.Lock()
+	defer self.Mutex.Unlock()
+
+	Info, Error := self.File.Stat()
+	if Error != nil {
+		return nil, Error
+	}
+	var Contents []byte = make([]byte, Info.Size())
+	if _, Error := self.File.ReadAt(Contents, 0); Error != nil && !errors.Is(Error, io.EOF) {
+		return nil, fmt.Errorf("Failed to read write-ahead log: %w", Error)
+	}
+	if len(Contents) < walHeaderSize || string(Contents[0:8]) != WALMagic {
+		return nil, fmt.Errorf("Not a write-ahead log: %s", self.FilePath)
+	}
+	self.nextLSN = binary.LittleEndian.Uint64(Contents[8:16])
+
+	var Records []*LogRecord
+	var Offset int = walHeaderSize
+	for Offset+walFrameSize <= len(Contents) {
+		var Length int = int(binary.LittleEndian.Uint32(Contents[Offset:]))
+		var Checksum uint32 = binary.LittleEndian.Uint32(Contents[Offset+4:])
+		var End int = Offset + walFrameSize + Length
+		if End > len(Contents) || crc32.ChecksumIEEE(Contents[Offset+walFrameSize:End]) != Checksum {
+			break
+		}
+		Record, Error := decodeLogRecord(Contents[Offset+walFrameSize : End])
+		if Error != nil {
+			break
+		}
+		Records = append(Records, Record)
+		self.nextLSN = Record.LSN + 1
+		Offset = End
+	}
+
+	if int64(Offset) != Info.Size() {
+		if Error := self.File.Truncate(int64(Offset)); Error != nil {
+			return nil, fmt.Errorf("Failed to cut torn records from write-ahead log: %w", Error)
+		}
+	}
+	self.size = int64(Offset)
+	self.flushedLSN = self.nextLSN - 1
+	return Records, nil
+}
+
+// Close syncs and closes the log file.
+func (self *WriteAheadLog) Close() error {
+	self.Mutex.Lock()
+	defer self.Mutex.Unlock()
+	if self.File == nil {
+		return nil
+	}
+	var SyncErr error = syncFile(self.File, self.SyncMode)
+	if Error := self.File.Close(); Error != nil {
+		return Error
+	}
+	self.File = nil
+	return SyncErr
+}
+
+// reset empties the log and writes a header that starts it at StartLSN.
+func (self *WriteAheadLog) reset(StartLSN uint64) error {
+	var Header []byte = make([]byte, walHeaderSize)
+	copy(Header[0:8], WALMagic)
+	binary.LittleEndian.PutUint64(Header[8:16], StartLSN)
+
+	if Error := self.File.Truncate(0); Error != nil {
+		return fmt.Errorf("Failed to truncate write-ahead log: %w", Error)
+	}
+	if _, Error := self.File.WriteAt(Header, 0); Error != nil {
+		return fmt.Errorf("Failed to write write-ahead log header: %w", Error)
+	}
+	if Error := syncFile(self.File, self.SyncMode); Error != nil {
+		return fmt.Errorf("Failed to sync write-ahead log: %w", Error)
+	}
+	self.nextLSN = StartLSN
+	self.flushedLSN = StartLSN - 1
+	self.size = int64(walHeaderSize)
+	return nil
+}
+
+// encodeLogRecord serializes a record into a frame payload.
+func encodeLogRecord(Record *LogRecord) []byte {
+	var Payload []byte
+	Payload = binary.AppendUvarint(Payload, Record.LSN)
+	Payload = binary.AppendUvarint(Payload, Record.TxID)
+	Payload = append(Payload, byte(Record.Type))
+	Payload = binary.AppendUvarint(Payload, uint64(Record.PageID))
+
+	var Flags byte
+	if Record.Before != nil {
+		Flags |= walHasBefore
+	}
+	if Record.After != nil {
+		Flags |= walHasAfter
+	}
+	Payload = append(Payload, Flags)
+	if Record.Before != nil {
+		Payload = appendBinaryString(Payload, string(encodeBinaryPage(Record.Before)))
+	}
+	if Record.After != nil {
+		Payload = appendBinaryString(Payload, string(encodeBinaryPage(Record.After)))
+	}
+	return Payload
+}
+
+// decodeLogRecord parses a frame payload written by encodeLogRecord.
+func decodeLogRecord(Payload []byte) (*LogRecord, error) {
+	var Record *LogRecord = &LogRecord{}
+	var Offset int
+
+	var ReadUvarint func() (uint64, error) = func() (uint64, error) {
+		Value, Length := binary.Uvarint(Payload[Offset:])
+		if Length <= 0 {
+			return 0, fmt.Errorf("malformed log record")
+		}
+		Offset += Length
+		return Value, nil
+	}
+	var ReadByte func() (byte, error) = func() (byte, error) {
+		if Offset >= len(Payload) {
+			return 0, fmt.Errorf("malformed log record")
+		}
+		Offset++
+		return Payload[Offset-1], nil
+	}
+	var ReadPage func() (*Page, error) = func() (*Page, error) {
+		Length, Error := ReadUvarint()
+		if Error != nil {
+			return nil, Error
+		}
+		if Length > uint64(len(Payload)-Offset) {
+			return nil, fmt.Errorf("malformed log record")
+		}
+		Offset += int(Length)
+		return decodeBinaryPage(Payload[Offset-int(Length) : Offset])
+	}
+
+	var Error error
+	if Record.LSN, Error = ReadUvarint(); Error != nil {
+		return nil, Error
+	}
+	if Record.TxID, Error = ReadUvarint(); Error != nil {
+		return nil, Error
+	}
+	Type, Error := ReadByte()
+	if Error != nil {
+		return nil, Error
+	}
+	Record.Type = LogRecordType(Type)
+	PageID, Error := ReadUvarint()
+	if Error != nil {
+		return nil, Error
+	}
+	Record.PageID = uint(PageID)
+	Flags, Error := ReadByte()
+	if Error != nil {
+		return nil, Error
+	}
+	if Flags&walHasBefore != 0 {
+		if Record.Before, Error = ReadPage(); Error != nil {
+			return nil, Error
+		}
+	}
+	if Flags&walHasAfter != 0 {
+		if Record.After, Error = ReadPage(); Error != nil {
+			return nil, Error
+		}
+	}
+	return Record, nil
+}
@@ -0,0 +1,145 @@
+package storage
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestWriteAheadLogStampsPagesAndReopens(t *testing.T) {
+	for _, Format := range fileFormats {
+		for _, Frames := range []int{0, 8} {
+			var Path string = testPath(t)
+			db := openTest(t, Path, WithFormat(Format), WithBufferPool(Frames))
+			for i := 0; i < 100; i++ {
+				if err := db.Insert(fmt.Sprintf("k%03d", i), strings.Repeat("x", i)); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if err := db.Insert(strings.Repeat("K", 1000), "v"); err == nil {
+				t.Fatalf("%v/%d: Insert accepted an oversized ID", Format, Frames)
+			}
+			if db.Index.KeyCount != 100 {
+				t.Fatalf("%v/%d: KeyCount is %d after a failed insert", Format, Frames, db.Index.KeyCount)
+			}
+			if err := db.Insert("zzz", strings.Repeat("y", 3000)); err != nil {
+				t.Fatal(err)
+			}
+			Page, err := db.Store.ReadPage(1)
+			if err != nil || Page.Header.PageLSN == 0 {
+				t.Fatalf("%v/%d: page 1 carries no LSN: %v", Format, Frames, err)
+			}
+			Records, err := db.Log.WAL.Records()
+			if err != nil || len(Records) == 0 {
+				t.Fatalf("%v/%d: log holds %d records, %v", Format, Frames, len(Records), err)
+			}
+			if err := db.Close(); err != nil {
+				t.Fatal(err)
+			}
+
+			db = openTest(t, Path, WithBufferPool(Frames))
+			for i := 0; i < 100; i++ {
+				if Record, err := db.Get(fmt.Sprintf("k%03d", i)); err != nil || Record == nil {
+					t.Fatalf("%v/%d: Get k%03d: %v", Format, Frames, i, err)
+				}
+			}
+			if Record, _ := db.Get("zzz"); Record == nil {
+				t.Fatalf("%v/%d: zzz lost", Format, Frames)
+			}
+			if Count := countKeys(t, db.Index); Count != 101 {
+				t.Fatalf("%v/%d: index holds %d keys, want 101", Format, Frames, Count)
+			}
+			db.Close()
+		}
+	}
+}
+
+func TestWriteAheadLogShorterThanHeader(t *testing.T) {
+	for _, Format := range fileFormats {
+		for _, Size := range []int64{0, 7} {
+			var Path string = testPath(t)
+			db := openTest(t, Path, WithFormat(Format))
+			insertKeys(t, db, "k", 20, "v")
+			if err := db.Checkpoint(); err != nil {
+				t.Fatal(err)
+			}
+			var NextLSN uint64 = db.Log.WAL.NextLSN()
+			if err := db.Close(); err != nil {
+				t.Fatal(err)
+			}
+			if err := os.Truncate(Path+WALSuffix, Size); err != nil {
+				t.Fatal(err)
+			}
+
+			db = openTest(t, Path)
+			if db.Log.WAL.NextLSN() < NextLSN {
+				t.Fatalf("%v/%d: log restarted at LSN %d, before %d", Format, Size, db.Log.WAL.NextLSN(), NextLSN)
+			}
+			for i := 0; i < 20; i++ {
+				if Record, _ := db.Get(fmt.Sprintf("k%03d", i)); Record == nil {
+					t.Fatalf("%v/%d: k%03d lost", Format, Size, i)
+				}
+			}
+			if err := db.Insert("new", "v"); err != nil {
+				t.Fatal(err)
+			}
+			if err := db.Close(); err != nil {
+				t.Fatal(err)
+			}
+
+			db = openTest(t, Path)
+			if Record, _ := db.Get("new"); Record == nil {
+				t.Fatalf("%v/%d: record written after the restart lost", Format, Size)
+			}
+			db.Close()
+		}
+	}
+}
+
+func TestCheckpoint(t *testing.T) {
+	for _, Format := range fileFormats {
+		var Path string = testPath(t)
+		db := openTest(t, Path, WithFormat(Format))
+		insertKeys(t, db, "a", 100, "v")
+		var Before int64 = db.Log.WAL.Size()
+		if err := db.Checkpoint(); err != nil {
+			t.Fatalf("Checkpoint: %v", err)
+		}
+		if db.Log.WAL.Size() >= Before {
+			t.Fatalf("%v: checkpoint left the log at %d bytes, was %d", Format, db.Log.WAL.Size(), Before)
+		}
+		insertKeys(t, db, "b", 50, "v")
+		crash(db)
+
+		db = openTest(t, Path, WithAutoCheckpoint(20000))
+		if db.Recovery.CheckpointLSN == 0 {
+			t.Fatalf("%v: recovery did not start from the checkpoint", Format)
+		}
+		for _, Prefix := range []string{"a", "b"} {
+			var N int = map[string]int{"a": 100, "b": 50}[Prefix]
+			for i := 0; i < N; i++ {
+				if Record, _ := db.Get(fmt.Sprintf("%s%03d", Prefix, i)); Record == nil {
+					t.Fatalf("%v: %s%03d lost", Format, Prefix, i)
+				}
+			}
+		}
+		for i := 0; i < 250; i++ {
+			if err := db.Insert(fmt.Sprintf("c%03d", i), "v"); err != nil {
+				t.Fatal(err)
+			}
+			if db.Log.WAL.Size() > 40000 {
+				t.Fatalf("%v: log grew to %d bytes despite the automatic checkpoint", Format, db.Log.WAL.Size())
+			}
+		}
+		if err := db.Close(); err != nil {
+			t.Fatal(err)
+		}
+
+		db = openTest(t, Path)
+		if All, _ := db.Scan("", ""); len(All) != 400 {
+			t.Fatalf("%v: %d records after reopening, want 400", Format, len(All))
+		}
+		db.Close()
+	}
+}